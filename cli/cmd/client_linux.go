@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/google/uuid"
+)
+
+// sendServiceMessage connects to the service socket, sends the given message
+// and waits for the reply. The state included with the reply is returned. If
+// the service reports that the message failed, the error is returned.
+func sendServiceMessage(cfg *Config, msg service.Message) (service.State, error) {
+	conn, err := dialService(cfg)
+	if err != nil {
+		return service.State{}, err
+	}
+	defer conn.Close()
+
+	msg.ID = uuid.New().String()
+	if err := json.NewEncoder(conn).Encode(msg); err != nil {
+		return service.State{}, err
+	}
+
+	for decoder := json.NewDecoder(conn); decoder.More(); {
+		var update service.Update
+
+		if err := decoder.Decode(&update); err != nil {
+			return service.State{}, err
+		} else if update.Reply == nil || update.Reply.ID != msg.ID {
+			continue
+		} else if update.Reply.Error != "" {
+			return update.State, errors.New(update.Reply.Error)
+		} else {
+			return update.State, nil
+		}
+	}
+
+	return service.State{}, fmt.Errorf("service closed the connection before replying")
+}
@@ -1,13 +1,318 @@
 package cmd
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"maps"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+// PollConfig controls the fallback polling of the mug when event notifications stall
+type PollConfig struct {
+	Interval     time.Duration `toml:"interval" mapstructure:"interval"`           // Poll when no event arrived within this window (0 disables)
+	IdleInterval time.Duration `toml:"idle-interval" mapstructure:"idle-interval"` // Poll window while the mug is empty or charging
+}
+
+// HistoryConfig controls the optional recording of mug telemetry
+type HistoryConfig struct {
+	Enabled   bool          `toml:"enabled" mapstructure:"enabled"`     // Record every state change
+	MaxSize   int64         `toml:"max-size" mapstructure:"max-size"`   // Rotate the history file after this many bytes
+	Retention time.Duration `toml:"retention" mapstructure:"retention"` // Remove rotated history files older than this (0 keeps forever)
+}
+
+var (
+	ErrInvalidScheduleTime   = errors.New("invalid schedule time: expected 'HH:MM'")
+	ErrInvalidScheduleDay    = errors.New("invalid schedule day: expected 'mon'-'sun', 'weekdays' or 'weekends'")
+	ErrInvalidScheduleTarget = errors.New("schedule rule must define either a 'preset' or a temperature")
+)
+
+// ScheduleConfig defines a time of day at which the target temperature (and
+// optionally LED color) is changed. The target is either taken from a named
+// preset, or defined inline in the same way as a preset.
+type ScheduleConfig struct {
+	Time         string   `toml:"time" mapstructure:"time"`     // Time of day in 24-hour 'HH:MM' format
+	Days         []string `toml:"days" mapstructure:"days"`     // Days the rule applies ('mon'-'sun', 'weekdays', 'weekends'). Empty for every day.
+	Preset       string   `toml:"preset" mapstructure:"preset"` // Name of a preset to apply
+	PresetConfig `mapstructure:",squash"`
+}
+
+var scheduleDays = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// ScheduleRule converts the configuration to a [service.ScheduleRule]. Preset
+// names are resolved using the given presets.
+func (s ScheduleConfig) ScheduleRule(presets []service.Preset) (rule service.ScheduleRule, err error) {
+	if t, err := time.Parse("15:04", s.Time); err != nil {
+		return rule, fmt.Errorf("%w: %q", ErrInvalidScheduleTime, s.Time)
+	} else {
+		rule.Hour = t.Hour()
+		rule.Minute = t.Minute()
+	}
+
+	for _, day := range s.Days {
+		if days, ok := scheduleDays[strings.ToLower(day)]; !ok {
+			return rule, fmt.Errorf("%w: %q", ErrInvalidScheduleDay, day)
+		} else {
+			rule.Days = append(rule.Days, days...)
+		}
+	}
+
+	if s.Preset == "" {
+		if preset, err := s.PresetConfig.Preset(""); err != nil {
+			return rule, err
+		} else {
+			rule.Target = preset.Target
+			rule.Color = preset.Color
+		}
+	} else if s.PresetConfig != (PresetConfig{}) {
+		return rule, ErrInvalidScheduleTarget
+	} else if index := slices.IndexFunc(presets, func(p service.Preset) bool {
+		return p.Name == strings.ToLower(s.Preset)
+	}); index == -1 {
+		return rule, fmt.Errorf("%w: %q", service.ErrUnknownPreset, s.Preset)
+	} else {
+		rule.Target = presets[index].Target
+		rule.Color = presets[index].Color
+	}
+
+	return rule, nil
+}
+
+// NotificationTrigger names the condition which causes a notification rule to fire
+type NotificationTrigger string
+
+const (
+	TriggerTargetReached    NotificationTrigger = "target-reached"    // Mug reached the stable target temperature
+	TriggerBatteryLow       NotificationTrigger = "battery-low"       // Battery dropped to or below 'battery' percent while discharging
+	TriggerChargingComplete NotificationTrigger = "charging-complete" // Battery fully charged
+	TriggerEmptied          NotificationTrigger = "emptied"           // Mug was emptied
+	TriggerDisconnected     NotificationTrigger = "disconnected"      // Mug disconnected (combine with 'debounce' for "longer than")
+	TriggerTemperatureBelow NotificationTrigger = "temperature-below" // Liquid temperature dropped below 'fahrenheit' or 'celsius'
 )
 
+// NotificationConfig defines a single desktop notification rule. The summary
+// and body are 'text/template' template strings executed with [service.State].
+type NotificationConfig struct {
+	Trigger    NotificationTrigger `toml:"trigger" mapstructure:"trigger"`       // Condition which fires the rule
+	Battery    int                 `toml:"battery" mapstructure:"battery"`       // Battery percentage for 'battery-low'
+	Fahrenheit float64             `toml:"fahrenheit" mapstructure:"fahrenheit"` // Threshold for 'temperature-below'
+	Celsius    float64             `toml:"celsius" mapstructure:"celsius"`       // Threshold for 'temperature-below'
+	Summary    string              `toml:"summary" mapstructure:"summary"`       // Golang Template String for the summary
+	Body       string              `toml:"body" mapstructure:"body"`             // Golang Template String for the body
+	Urgency    string              `toml:"urgency" mapstructure:"urgency"`       // One of 'low', 'normal' (default) or 'critical'
+	Icon       string              `toml:"icon" mapstructure:"icon"`             // Icon name or absolute path
+	Timeout    time.Duration       `toml:"timeout" mapstructure:"timeout"`       // Time the notification is shown (0 uses the server default)
+	Cooldown   time.Duration       `toml:"cooldown" mapstructure:"cooldown"`     // Minimum time between notifications from this rule
+	Debounce   time.Duration       `toml:"debounce" mapstructure:"debounce"`     // Time the condition must hold before notifying
+
+	Actions []NotificationActionConfig `toml:"actions" mapstructure:"actions"` // Buttons shown on the notification
+}
+
+// NotificationActionConfig defines a button on a desktop notification. Each
+// action runs exactly one service command when invoked.
+type NotificationActionConfig struct {
+	Label            string  `toml:"label" mapstructure:"label"`                         // Button label
+	Preset           string  `toml:"preset" mapstructure:"preset"`                       // Apply the named preset
+	Fahrenheit       float64 `toml:"fahrenheit" mapstructure:"fahrenheit"`               // Set the target temperature in fahrenheit
+	Celsius          float64 `toml:"celsius" mapstructure:"celsius"`                     // Set the target temperature in celsius
+	AdjustFahrenheit float64 `toml:"adjust-fahrenheit" mapstructure:"adjust-fahrenheit"` // Raise (or lower) the target by degrees fahrenheit
+	AdjustCelsius    float64 `toml:"adjust-celsius" mapstructure:"adjust-celsius"`       // Raise (or lower) the target by degrees celsius
+	Reconnect        bool    `toml:"reconnect" mapstructure:"reconnect"`                 // Reconnect to the mug
+}
+
+// HookConfig defines a shell command executed when the mug state changes.
+// The command is run with '/bin/sh -c', receives the [service.State] as JSON
+// on standard input, and the same state as EMBERMUG_* environment variables.
+type HookConfig struct {
+	On      []Transition  `toml:"on" mapstructure:"on"`           // Transitions which run the command
+	Command string        `toml:"command" mapstructure:"command"` // Shell command to execute
+	Timeout time.Duration `toml:"timeout" mapstructure:"timeout"` // Time after which the command is killed (default 30s)
+}
+
+// WebhookConfig defines an HTTP endpoint which receives a POST request when
+// the mug state transitions. The body is a JSON [webhookPayload] unless a
+// 'text/template' body template is given, which is executed with the payload.
+type WebhookConfig struct {
+	URL         string            `toml:"url" mapstructure:"url"`                   // Endpoint URL
+	On          []Transition      `toml:"on" mapstructure:"on"`                     // Transitions which trigger the webhook (all if empty)
+	Secret      string            `toml:"secret" mapstructure:"secret"`             // HMAC-SHA256 key used to sign the body
+	Body        string            `toml:"body" mapstructure:"body"`                 // Optional Golang Template String for the body
+	ContentType string            `toml:"content-type" mapstructure:"content-type"` // Content type of the body (default application/json)
+	Headers     map[string]string `toml:"headers" mapstructure:"headers"`           // Additional request headers
+	Timeout     time.Duration     `toml:"timeout" mapstructure:"timeout"`           // Timeout of a single request (default 10s)
+	Retries     int               `toml:"retries" mapstructure:"retries"`           // Number of retries after a failed request (default 3, -1 disables retries)
+	Backoff     time.Duration     `toml:"backoff" mapstructure:"backoff"`           // Delay before the first retry, doubled for each retry (default 1s)
+}
+
+// MQTTConfig defines the connection to an MQTT broker. The mug state is
+// published to retained topics under '<topic-prefix>/<device>', and commands
+// are accepted on the '/set' topics below it.
+type MQTTConfig struct {
+	Broker          string `toml:"broker" mapstructure:"broker"`                     // Broker URL such as 'tcp://localhost:1883' (empty disables MQTT)
+	ClientID        string `toml:"client-id" mapstructure:"client-id"`               // Client identifier (defaults to the device identifier)
+	Username        string `toml:"username" mapstructure:"username"`                 // Optional username
+	Password        string `toml:"password" mapstructure:"password"`                 // Optional password
+	TopicPrefix     string `toml:"topic-prefix" mapstructure:"topic-prefix"`         // Prefix of the state and command topics
+	Discovery       bool   `toml:"discovery" mapstructure:"discovery"`               // Whether to publish Home Assistant discovery payloads
+	DiscoveryPrefix string `toml:"discovery-prefix" mapstructure:"discovery-prefix"` // Home Assistant discovery prefix
+}
+
+// MetricsConfig defines the HTTP listener exposing Prometheus metrics
+type MetricsConfig struct {
+	Listen string `toml:"listen" mapstructure:"listen"` // Listen address such as '127.0.0.1:9595' (empty disables metrics)
+}
+
+// HTTPConfig defines the HTTP REST API listener
+type HTTPConfig struct {
+	Listen string `toml:"listen" mapstructure:"listen"` // Listen address such as '127.0.0.1:8080' (empty disables the API)
+	Token  string `toml:"token" mapstructure:"token"`   // Bearer token required for requests (empty disables authentication)
+}
+
+// ListenerConfig defines an additional socket where the service accepts
+// clients. Either the address of a socket to open (such as '/run/embermug.sock',
+// 'tcp://0.0.0.0:7878' or 'tls://0.0.0.0:7878'), or the name of a systemd
+// activated socket (its FileDescriptorName) must be given. TCP clients must
+// authenticate with the token, a certificate signed by the client CA, or both.
+type ListenerConfig struct {
+	Address  string `toml:"address" mapstructure:"address"`
+	Name     string `toml:"name" mapstructure:"name"`           // FileDescriptorName of a systemd activated socket
+	Role     string `toml:"role" mapstructure:"role"`           // Either 'read-only' or 'control' (default)
+	Mode     string `toml:"mode" mapstructure:"mode"`           // Octal permissions of a unix socket, such as '0660'
+	Group    string `toml:"group" mapstructure:"group"`         // Group owning a unix socket
+	Token    string `toml:"token" mapstructure:"token"`         // Token clients must send before any message
+	Cert     string `toml:"cert" mapstructure:"cert"`           // PEM server certificate for TLS listeners
+	Key      string `toml:"key" mapstructure:"key"`             // PEM server private key for TLS listeners
+	ClientCA string `toml:"client-ca" mapstructure:"client-ca"` // PEM CA bundle which must have signed client certificates
+}
+
+// RemoteConfig defines how clients authenticate when 'socket-path' is a
+// 'tcp://' or 'tls://' address.
+type RemoteConfig struct {
+	Token      string `toml:"token" mapstructure:"token"`             // Token sent to the service
+	CA         string `toml:"ca" mapstructure:"ca"`                   // PEM CA bundle used to verify the service (system roots if empty)
+	Cert       string `toml:"cert" mapstructure:"cert"`               // PEM client certificate
+	Key        string `toml:"key" mapstructure:"key"`                 // PEM client private key
+	ServerName string `toml:"server-name" mapstructure:"server-name"` // Name expected in the service certificate (defaults to the host)
+}
+
+// AccessConfig grants a role to socket clients running as one of the users,
+// or as a member of one of the groups. Users and groups may be given by name
+// or by numeric ID.
+type AccessConfig struct {
+	Users  []string `toml:"users" mapstructure:"users"`
+	Groups []string `toml:"groups" mapstructure:"groups"`
+	Role   string   `toml:"role" mapstructure:"role"` // Either 'read-only' or 'control'
+}
+
+// AccessRule converts the configuration to a [service.AccessRule], resolving
+// user and group names.
+func (a AccessConfig) AccessRule() (rule service.AccessRule, err error) {
+	if len(a.Users) == 0 && len(a.Groups) == 0 {
+		return rule, ErrEmptyAccessRule
+	}
+
+	if rule.Role, err = service.ParseRole(a.Role); err != nil {
+		return rule, err
+	}
+
+	for _, name := range a.Users {
+		if id, err := lookupUserID(name); err != nil {
+			return rule, fmt.Errorf("user %q: %w", name, err)
+		} else {
+			rule.UIDs = append(rule.UIDs, id)
+		}
+	}
+
+	for _, name := range a.Groups {
+		if id, err := lookupGroupID(name); err != nil {
+			return rule, fmt.Errorf("group %q: %w", name, err)
+		} else {
+			rule.GIDs = append(rule.GIDs, id)
+		}
+	}
+
+	return rule, nil
+}
+
+// lookupUserID parses a numeric user ID, or resolves a user name to its ID
+func lookupUserID(name string) (uint32, error) {
+	return lookupID(name, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+}
+
+// lookupGroupID parses a numeric group ID, or resolves a group name to its ID
+func lookupGroupID(name string) (uint32, error) {
+	return lookupID(name, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+}
+
+// lookupID parses a numeric user or group ID, or resolves a name to an ID
+// with the given lookup function.
+func lookupID(name string, lookup func(name string) (string, error)) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+
+	text, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(text, 10, 32)
+	return uint32(id), err
+}
+
 // ServiceConfig holds the configuration specific to the embermug service
 type ServiceConfig struct {
-	DeviceAddress       string `toml:"device-address" mapstructure:"device-address"`
-	EnableNotifications bool   `toml:"enable-notifications" mapstructure:"enable-notifications"`
+	DeviceAddress       string               `toml:"device-address" mapstructure:"device-address"`
+	EnableNotifications bool                 `toml:"enable-notifications" mapstructure:"enable-notifications"`
+	Poll                PollConfig           `toml:"poll" mapstructure:"poll"`
+	History             HistoryConfig        `toml:"history" mapstructure:"history"`
+	Schedule            []ScheduleConfig     `toml:"schedule" mapstructure:"schedule"`
+	ScheduleCatchUp     bool                 `toml:"schedule-catch-up" mapstructure:"schedule-catch-up"` // Apply the most recent schedule rule on startup
+	SyncClock           bool                 `toml:"sync-clock" mapstructure:"sync-clock"`
+	Notifications       []NotificationConfig `toml:"notifications" mapstructure:"notifications"`
+	BatteryLow          int                  `toml:"battery-low" mapstructure:"battery-low"`           // Battery percentage for the 'battery-low' transition
+	Hooks               []HookConfig         `toml:"hooks" mapstructure:"hooks"`                       // Commands executed on state transitions
+	HookConcurrency     int                  `toml:"hook-concurrency" mapstructure:"hook-concurrency"` // Maximum number of hook commands running at once
+	Webhooks            []WebhookConfig      `toml:"webhooks" mapstructure:"webhooks"`                 // HTTP endpoints notified on state transitions
+	MQTT                MQTTConfig           `toml:"mqtt" mapstructure:"mqtt"`                         // MQTT bridge
+	Metrics             MetricsConfig        `toml:"metrics" mapstructure:"metrics"`                   // Prometheus metrics endpoint
+	HTTP                HTTPConfig           `toml:"http" mapstructure:"http"`                         // HTTP REST API
+	EnableDBus          bool                 `toml:"enable-dbus" mapstructure:"enable-dbus"`           // Export the mug on the D-Bus session bus
+	DBusBattery         bool                 `toml:"dbus-battery" mapstructure:"dbus-battery"`         // Also export the battery as a UPower style device
+	Access              []AccessConfig       `toml:"access" mapstructure:"access"`                     // Socket client allowlist (empty allows every client)
+	SocketMode          string               `toml:"socket-mode" mapstructure:"socket-mode"`           // Octal permissions of the socket, such as '0660' (empty uses the umask)
+	SocketGroup         string               `toml:"socket-group" mapstructure:"socket-group"`         // Group owning the socket
+	Listeners           []ListenerConfig     `toml:"listeners" mapstructure:"listeners"`               // Additional and systemd activated sockets
+	IdleExit            time.Duration        `toml:"idle-exit" mapstructure:"idle-exit"`               // Exit after this long without socket clients when socket activated (zero disables)
 }
 
 // PercentageSource defines the value to place in the 'percentage' field of
@@ -63,9 +368,126 @@ type WaybarConfig struct {
 	Default      *WaybarBlockConfig           `toml:"default" mapstructure:"default"`           // Default block config
 }
 
+var (
+	ErrInvalidPresetTemperature = errors.New("preset must define exactly one of 'fahrenheit' or 'celsius'")
+	ErrInvalidColor             = errors.New("invalid color: expected '#RRGGBB' or '#RRGGBBAA'")
+	ErrEmptyAccessRule          = errors.New("access rule must list at least one user or group")
+)
+
+// PresetConfig defines a named target temperature with an optional LED color.
+// The temperature may be given in either fahrenheit or celsius.
+type PresetConfig struct {
+	Fahrenheit float64 `toml:"fahrenheit" mapstructure:"fahrenheit"` // Target temperature in fahrenheit
+	Celsius    float64 `toml:"celsius" mapstructure:"celsius"`       // Target temperature in celsius
+	Color      string  `toml:"color" mapstructure:"color"`           // Optional LED color as '#RRGGBB' or '#RRGGBBAA'
+}
+
+// Preset converts the configuration to a [service.Preset] with the given name.
+func (p PresetConfig) Preset(name string) (preset service.Preset, err error) {
+	preset.Name = name
+
+	switch {
+	case p.Fahrenheit != 0 && p.Celsius == 0:
+		preset.Target = embermug.Fahrenheit(p.Fahrenheit)
+	case p.Celsius != 0 && p.Fahrenheit == 0:
+		preset.Target = embermug.Celsius(p.Celsius)
+	default:
+		return preset, ErrInvalidPresetTemperature
+	}
+
+	if preset.Target < service.MinTarget || preset.Target > service.MaxTarget {
+		return preset, fmt.Errorf(
+			"%w: %.1fF (expected %.1fF to %.1fF)",
+			service.ErrTargetOutOfRange,
+			preset.Target.Fahrenheit(),
+			service.MinTarget.Fahrenheit(),
+			service.MaxTarget.Fahrenheit(),
+		)
+	}
+
+	if p.Color != "" {
+		if color, err := parseColor(p.Color); err != nil {
+			return preset, err
+		} else {
+			preset.Color = &color
+		}
+	}
+
+	return preset, nil
+}
+
+// parseColor parses a color in '#RRGGBB' or '#RRGGBBAA' format. The alpha
+// channel defaults to fully opaque.
+func parseColor(text string) (embermug.Color, error) {
+	var color = embermug.Color{Alpha: 255}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(text, "#"))
+	if err != nil || (len(data) != 3 && len(data) != 4) {
+		return color, fmt.Errorf("%w: %q", ErrInvalidColor, text)
+	}
+
+	color.Red = data[0]
+	color.Green = data[1]
+	color.Blue = data[2]
+	if len(data) == 4 {
+		color.Alpha = data[3]
+	}
+
+	return color, nil
+}
+
 type Config struct {
 	// LogLevel   slog.Level    `toml:"log-level" mapstructure:"log-level"`
-	SocketPath string        `toml:"socket-path" mapstructure:"socket-path"`
-	Service    ServiceConfig `toml:"service" mapstructure:"service"`
-	Waybar     WaybarConfig  `toml:"waybar" mapstructure:"waybar"`
+	SocketPath string                  `toml:"socket-path" mapstructure:"socket-path"`
+	Remote     RemoteConfig            `toml:"remote" mapstructure:"remote"`
+	Service    ServiceConfig           `toml:"service" mapstructure:"service"`
+	Waybar     WaybarConfig            `toml:"waybar" mapstructure:"waybar"`
+	Presets    map[string]PresetConfig `toml:"presets" mapstructure:"presets"`
+}
+
+// ServicePresets converts the configured presets to [service.Preset] objects
+// ordered by name.
+func (c *Config) ServicePresets() ([]service.Preset, error) {
+	var presets []service.Preset
+
+	for _, name := range slices.Sorted(maps.Keys(c.Presets)) {
+		if preset, err := c.Presets[name].Preset(name); err != nil {
+			return nil, fmt.Errorf("preset %q: %w", name, err)
+		} else {
+			presets = append(presets, preset)
+		}
+	}
+
+	return presets, nil
+}
+
+// ServiceAccessRules converts the configured socket access rules to
+// [service.AccessRule] objects.
+func (c *Config) ServiceAccessRules() ([]service.AccessRule, error) {
+	var rules []service.AccessRule
+
+	for index, cfg := range c.Service.Access {
+		if rule, err := cfg.AccessRule(); err != nil {
+			return nil, fmt.Errorf("access rule %v: %w", index, err)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// ServiceSchedule converts the configured schedule to [service.ScheduleRule] objects
+func (c *Config) ServiceSchedule(presets []service.Preset) ([]service.ScheduleRule, error) {
+	var rules []service.ScheduleRule
+
+	for index, cfg := range c.Service.Schedule {
+		if rule, err := cfg.ScheduleRule(presets); err != nil {
+			return nil, fmt.Errorf("schedule rule %v: %w", index, err)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
 }
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+func TestScheduleConfigRule(t *testing.T) {
+	var (
+		green   = embermug.Color{Green: 0xff, Alpha: 0xff}
+		presets = []service.Preset{
+			{Name: "coffee", Target: embermug.Fahrenheit(135), Color: &green},
+			{Name: "tea", Target: embermug.Celsius(60)},
+		}
+		weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	)
+
+	tests := []struct {
+		name     string
+		config   ScheduleConfig
+		expected service.ScheduleRule
+		err      error
+	}{
+		{
+			name:     "inline",
+			config:   ScheduleConfig{Time: "07:30", PresetConfig: PresetConfig{Celsius: 57, Color: "#00ff00"}},
+			expected: service.ScheduleRule{Hour: 7, Minute: 30, Target: embermug.Celsius(57), Color: &green},
+		},
+		{
+			name:     "preset",
+			config:   ScheduleConfig{Time: "23:59", Preset: "Coffee"},
+			expected: service.ScheduleRule{Hour: 23, Minute: 59, Target: embermug.Fahrenheit(135), Color: &green},
+		},
+		{
+			name:     "weekdays",
+			config:   ScheduleConfig{Time: "00:00", Days: []string{"Weekdays"}, Preset: "tea"},
+			expected: service.ScheduleRule{Days: weekdays, Target: embermug.Celsius(60)},
+		},
+		{
+			name:     "days",
+			config:   ScheduleConfig{Time: "09:05", Days: []string{"weekends", "wed"}, Preset: "tea"},
+			expected: service.ScheduleRule{Hour: 9, Minute: 5, Days: []time.Weekday{time.Saturday, time.Sunday, time.Wednesday}, Target: embermug.Celsius(60)},
+		},
+		{name: "hour", config: ScheduleConfig{Time: "24:00", Preset: "tea"}, err: ErrInvalidScheduleTime},
+		{name: "seconds", config: ScheduleConfig{Time: "07:30:00", Preset: "tea"}, err: ErrInvalidScheduleTime},
+		{name: "twelve hour", config: ScheduleConfig{Time: "7:30pm", Preset: "tea"}, err: ErrInvalidScheduleTime},
+		{name: "day", config: ScheduleConfig{Time: "07:30", Days: []string{"monday"}, Preset: "tea"}, err: ErrInvalidScheduleDay},
+		{name: "unknown preset", config: ScheduleConfig{Time: "07:30", Preset: "cocoa"}, err: service.ErrUnknownPreset},
+		{name: "preset and temperature", config: ScheduleConfig{Time: "07:30", Preset: "tea", PresetConfig: PresetConfig{Celsius: 57}}, err: ErrInvalidScheduleTarget},
+		{name: "no target", config: ScheduleConfig{Time: "07:30"}, err: ErrInvalidPresetTemperature},
+		{name: "out of range", config: ScheduleConfig{Time: "07:30", PresetConfig: PresetConfig{Celsius: 90}}, err: service.ErrTargetOutOfRange},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := test.config.ScheduleRule(presets)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error = %v, expected %v", err, test.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("ScheduleRule: %v", err)
+			}
+
+			if rule.Hour != test.expected.Hour || rule.Minute != test.expected.Minute || rule.Target != test.expected.Target {
+				t.Errorf("rule = %+v, expected %+v", rule, test.expected)
+			}
+			if !slices.Equal(rule.Days, test.expected.Days) {
+				t.Errorf("days = %v, expected %v", rule.Days, test.expected.Days)
+			}
+			if (rule.Color == nil) != (test.expected.Color == nil) || (rule.Color != nil && *rule.Color != *test.expected.Color) {
+				t.Errorf("color = %v, expected %v", rule.Color, test.expected.Color)
+			}
+		})
+	}
+}
+
+func TestConfigServiceSchedule(t *testing.T) {
+	var cfg Config
+	cfg.Service.Schedule = []ScheduleConfig{
+		{Time: "07:00", PresetConfig: PresetConfig{Fahrenheit: 135}},
+		{Time: "noon", PresetConfig: PresetConfig{Fahrenheit: 135}},
+	}
+
+	// Errors identify the rule
+	if _, err := cfg.ServiceSchedule(nil); !errors.Is(err, ErrInvalidScheduleTime) {
+		t.Fatalf("error = %v, expected %v", err, ErrInvalidScheduleTime)
+	} else if !strings.HasPrefix(err.Error(), "schedule rule 1: ") {
+		t.Errorf("error = %q, expected the rule index", err)
+	}
+
+	cfg.Service.Schedule = cfg.Service.Schedule[:1]
+	if rules, err := cfg.ServiceSchedule(nil); err != nil {
+		t.Fatalf("ServiceSchedule: %v", err)
+	} else if len(rules) != 1 || rules[0].Hour != 7 || rules[0].Target != embermug.Fahrenheit(135) {
+		t.Errorf("rules = %+v", rules)
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	dbusBusName   = "io.github.embermug"
+	dbusMugPath   = dbus.ObjectPath("/io/github/embermug/Mug")
+	dbusMugIface  = "io.github.embermug.Mug1"
+	dbusErrPrefix = dbusMugIface + ".Error."
+)
+
+// dbusMug implements the methods of the mug D-Bus interface. Every exported
+// method is exported on the bus, so helpers must not be added to this type.
+type dbusMug struct {
+	svc    *service.Service
+	logger *slog.Logger
+}
+
+// SetTarget sets the target temperature in degrees Celsius
+func (m *dbusMug) SetTarget(celsius float64) *dbus.Error {
+	return m.execute("SetTarget", service.Message{SetTarget: embermug.Celsius(celsius)})
+}
+
+// SetColor sets the LED color from a '#RRGGBB' or '#RRGGBBAA' string
+func (m *dbusMug) SetColor(text string) *dbus.Error {
+	color, err := parseColor(text)
+	if err != nil {
+		return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []any{err.Error()})
+	}
+
+	return m.execute("SetColor", service.Message{SetColor: &color})
+}
+
+// ApplyPreset applies the named temperature preset
+func (m *dbusMug) ApplyPreset(name string) *dbus.Error {
+	return m.execute("ApplyPreset", service.Message{ApplyPreset: name})
+}
+
+// Reconnect drops and re-establishes the bluetooth connection
+func (m *dbusMug) Reconnect() *dbus.Error {
+	return m.execute("Reconnect", service.Message{Reconnect: true})
+}
+
+// execute runs the message, and converts any failure into a D-Bus error
+func (m *dbusMug) execute(method string, msg service.Message) *dbus.Error {
+	err := m.svc.HandleMessage(msg)
+	if err == nil {
+		m.logger.Debug("Executed D-Bus method", "Method", method)
+		return nil
+	}
+
+	m.logger.Error("D-Bus method failed", "Method", method, "Error", err)
+
+	switch {
+	case errors.Is(err, service.ErrNotConnected):
+		return dbus.NewError(dbusErrPrefix+"NotConnected", []any{err.Error()})
+	case errors.Is(err, service.ErrTargetOutOfRange),
+		errors.Is(err, service.ErrUnknownPreset):
+		return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []any{err.Error()})
+	default:
+		return dbus.NewError(dbusErrPrefix+"Failed", []any{err.Error()})
+	}
+}
+
+// dbusMugProperties returns the values of the mug interface properties for
+// the given state.
+func dbusMugProperties(state service.State) map[string]any {
+	return map[string]any{
+		"Connected":          state.Connected,
+		"Name":               state.Name,
+		"State":              state.State.String(),
+		"CurrentTemperature": state.Current.Celsius(),
+		"TargetTemperature":  state.Target.Celsius(),
+		"Battery":            uint32(state.Battery.Charge),
+		"Charging":           state.Battery.Charging,
+		"HasLiquid":          state.HasLiquid,
+		"Preset":             state.Preset,
+	}
+}
+
+// exportDBusObject exports an object implementing a single interface with
+// the given methods (nil for none) and initial property values. The returned
+// properties are updated with [updateDBusProperties].
+func exportDBusObject(
+	conn *dbus.Conn,
+	path dbus.ObjectPath,
+	iface string,
+	object any,
+	methods []introspect.Method,
+	values map[string]any,
+) (*prop.Properties, error) {
+	var properties = make(map[string]*prop.Prop)
+	for name, value := range values {
+		properties[name] = &prop.Prop{Value: value, Emit: prop.EmitTrue}
+	}
+
+	if object != nil {
+		if err := conn.Export(object, path, iface); err != nil {
+			return nil, err
+		}
+	}
+
+	props, err := prop.Export(conn, path, prop.Map{iface: properties})
+	if err != nil {
+		return nil, err
+	}
+
+	node := &introspect.Node{
+		Name: string(path),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: iface, Methods: methods, Properties: props.Introspection(iface)},
+		},
+	}
+
+	if err := conn.Export(introspect.NewIntrospectable(node), path, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, err
+	}
+
+	return props, nil
+}
+
+// updateDBusProperties sets each property whose value differs from the given
+// values. Setting a property emits the PropertiesChanged signal, so unchanged
+// properties are skipped.
+func updateDBusProperties(props *prop.Properties, iface string, values map[string]any) {
+	for name, value := range values {
+		if props.GetMust(iface, name) != value {
+			props.SetMust(iface, name, value)
+		}
+	}
+}
+
+// dbusClient exports the mug on the session bus, and updates its properties
+// on every state change until the client context is cancelled. If battery is
+// true, the mug battery is also exported as a UPower style device.
+func dbusClient(svc *service.Service, client *service.Client, address string, battery bool) {
+	var logger = slog.With("ClientID", client.ID)
+
+	// A private connection, so the notification client closing the shared
+	// session bus connection does not affect the exported objects.
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		logger.Error("Could not connect to the session bus. D-Bus Interface Disabled.", "Error", err)
+		return
+	}
+	defer conn.Close()
+
+	var state = svc.State()
+
+	props, err := exportDBusObject(conn, dbusMugPath, dbusMugIface, &dbusMug{svc: svc, logger: logger}, []introspect.Method{
+		{Name: "SetTarget", Args: []introspect.Arg{{Name: "celsius", Type: "d", Direction: "in"}}},
+		{Name: "SetColor", Args: []introspect.Arg{{Name: "color", Type: "s", Direction: "in"}}},
+		{Name: "ApplyPreset", Args: []introspect.Arg{{Name: "preset", Type: "s", Direction: "in"}}},
+		{Name: "Reconnect"},
+	}, dbusMugProperties(state))
+	if err != nil {
+		logger.Error("Could not export mug object. D-Bus Interface Disabled.", "Error", err)
+		return
+	}
+
+	var batteryProps *prop.Properties
+	if battery {
+		batteryProps, err = exportDBusObject(conn, dbusBatteryPath, upowerDeviceIface, nil, nil, upowerDeviceProperties(state, address))
+		if err != nil {
+			logger.Error("Could not export battery object. D-Bus Battery Disabled.", "Error", err)
+			batteryProps = nil
+		}
+	}
+
+	if reply, err := conn.RequestName(dbusBusName, dbus.NameFlagDoNotQueue); err != nil {
+		logger.Error("Could not request bus name. D-Bus Interface Disabled.", "Name", dbusBusName, "Error", err)
+		return
+	} else if reply != dbus.RequestNameReplyPrimaryOwner {
+		logger.Error("Bus name is already owned. D-Bus Interface Disabled.", "Name", dbusBusName)
+		return
+	}
+
+	logger.Info("D-Bus Client Started", "Name", dbusBusName, "Path", dbusMugPath)
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			updateDBusProperties(props, dbusMugIface, dbusMugProperties(state))
+			if batteryProps != nil {
+				updateDBusProperties(batteryProps, upowerDeviceIface, upowerDeviceProperties(state, address))
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/godbus/dbus/v5"
+	"tinygo.org/x/bluetooth"
+)
+
+const dbusTestTimeout = 5 * time.Second
+
+// startDBusDaemon starts a private session bus, and points the session bus
+// address at it for the rest of the test.
+func startDBusDaemon(t *testing.T) {
+	t.Helper()
+
+	path, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	cmd := exec.Command(path, "--session", "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Could not start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Could not read bus address: %v", err)
+	}
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+}
+
+// startDBusClient starts the D-Bus client for a disconnected service, and
+// returns the channel used to send it state updates and a connection to the
+// bus once the client owns its name.
+func startDBusClient(t *testing.T, battery bool) (chan service.State, *dbus.Conn) {
+	t.Helper()
+	startDBusDaemon(t)
+
+	var (
+		svc = service.New(nil, bluetooth.Address{}, service.WithPresets(service.Preset{
+			Name:   "coffee",
+			Target: embermug.Fahrenheit(135),
+		}))
+		ctx, cancel = context.WithCancel(context.Background())
+		client      = &service.Client{
+			Channel: make(chan service.State),
+			Context: ctx,
+			Cancel:  cancel,
+			ID:      "test",
+		}
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		dbusClient(svc, client, "AA:BB:CC:DD:EE:FF", battery)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatalf("Could not connect to the test bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for deadline := time.Now().Add(dbusTestTimeout); ; time.Sleep(10 * time.Millisecond) {
+		var owned bool
+		if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, dbusBusName).Store(&owned); err != nil {
+			t.Fatalf("NameHasOwner: %v", err)
+		} else if owned {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("%v was never owned", dbusBusName)
+		}
+	}
+
+	return client.Channel, conn
+}
+
+// dbusProperty reads a single property of an exported object
+func dbusProperty(t *testing.T, conn *dbus.Conn, path dbus.ObjectPath, iface, name string) any {
+	t.Helper()
+
+	value, err := conn.Object(dbusBusName, path).GetProperty(iface + "." + name)
+	if err != nil {
+		t.Fatalf("Could not read %v.%v: %v", iface, name, err)
+	}
+	return value.Value()
+}
+
+// collectPropertiesChanged merges the PropertiesChanged signals of each
+// object, until no signal arrives for the quiet period. Each property is
+// announced by its own signal, so a state update causes several signals.
+func collectPropertiesChanged(t *testing.T, signals chan *dbus.Signal) map[dbus.ObjectPath]map[string]dbus.Variant {
+	t.Helper()
+
+	const quiet = 200 * time.Millisecond
+
+	var (
+		changed = make(map[dbus.ObjectPath]map[string]dbus.Variant)
+		timeout = time.After(dbusTestTimeout)
+		timer   = time.NewTimer(dbusTestTimeout)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("PropertiesChanged signals did not stop")
+		case <-timer.C:
+			return changed
+		case signal := <-signals:
+			if signal.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" {
+				continue
+			}
+
+			if changed[signal.Path] == nil {
+				changed[signal.Path] = make(map[string]dbus.Variant)
+			}
+			for name, value := range signal.Body[1].(map[string]dbus.Variant) {
+				changed[signal.Path][name] = value
+			}
+			timer.Reset(quiet)
+		}
+	}
+}
+
+func TestDBusProperties(t *testing.T) {
+	states, conn := startDBusClient(t, true)
+
+	if err := conn.AddMatchSignal(dbus.WithMatchInterface("org.freedesktop.DBus.Properties")); err != nil {
+		t.Fatalf("AddMatchSignal: %v", err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	if connected := dbusProperty(t, conn, dbusMugPath, dbusMugIface, "Connected"); connected != false {
+		t.Fatalf("Connected = %v before the mug connected", connected)
+	}
+
+	var state = service.State{
+		Connected: true,
+		Name:      "Office Mug",
+		State:     embermug.StateHeating,
+		HasLiquid: true,
+		Current:   embermug.Celsius(45),
+		Target:    embermug.Celsius(57),
+		Battery:   embermug.BatteryState{Charge: 80},
+	}
+	states <- state
+
+	var changed = collectPropertiesChanged(t, signals)
+
+	mug := changed[dbusMugPath]
+	for name, expected := range map[string]any{
+		"Connected":          true,
+		"Name":               "Office Mug",
+		"State":              embermug.StateHeating.String(),
+		"CurrentTemperature": 45.0,
+		"TargetTemperature":  57.0,
+		"Battery":            uint32(80),
+		"HasLiquid":          true,
+	} {
+		if value, ok := mug[name]; !ok {
+			t.Errorf("%v was not announced as changed", name)
+		} else if value.Value() != expected {
+			t.Errorf("changed %v = %v, expected %v", name, value.Value(), expected)
+		}
+		if value := dbusProperty(t, conn, dbusMugPath, dbusMugIface, name); value != expected {
+			t.Errorf("%v = %v, expected %v", name, value, expected)
+		}
+	}
+	for _, name := range []string{"Charging", "Preset"} {
+		if _, ok := mug[name]; ok {
+			t.Errorf("unchanged %v was announced as changed", name)
+		}
+	}
+
+	if percentage := changed[dbusBatteryPath]["Percentage"].Value(); percentage != 80.0 {
+		t.Errorf("battery Percentage = %v, expected 80", percentage)
+	}
+
+	// Only the properties which changed are announced
+	state.Current = embermug.Celsius(46)
+	states <- state
+
+	mug = collectPropertiesChanged(t, signals)[dbusMugPath]
+	if len(mug) != 1 || mug["CurrentTemperature"].Value() != 46.0 {
+		t.Errorf("changed = %v, expected only CurrentTemperature", mug)
+	}
+}
+
+func TestDBusMethodErrors(t *testing.T) {
+	_, conn := startDBusClient(t, false)
+
+	tests := []struct {
+		method string
+		args   []any
+		error  string
+	}{
+		{method: "SetTarget", args: []any{57.0}, error: dbusErrPrefix + "NotConnected"},
+		{method: "ApplyPreset", args: []any{"Coffee"}, error: dbusErrPrefix + "NotConnected"},
+		{method: "ApplyPreset", args: []any{"tea"}, error: "org.freedesktop.DBus.Error.InvalidArgs"},
+		{method: "SetColor", args: []any{"red"}, error: "org.freedesktop.DBus.Error.InvalidArgs"},
+		{method: "SetColor", args: []any{"#ff0000"}, error: dbusErrPrefix + "NotConnected"},
+	}
+
+	for index, test := range tests {
+		t.Run(test.method+"/"+strconv.Itoa(index), func(t *testing.T) {
+			call := conn.Object(dbusBusName, dbusMugPath).Call(dbusMugIface+"."+test.method, 0, test.args...)
+
+			var dbusErr dbus.Error
+			if !errors.As(call.Err, &dbusErr) {
+				t.Fatalf("%v(%v) = %v, expected %v", test.method, test.args, call.Err, test.error)
+			} else if dbusErr.Name != test.error {
+				t.Fatalf("%v(%v) = %v, expected %v", test.method, test.args, dbusErr.Name, test.error)
+			}
+		})
+	}
+}
+
+func TestDBusNameOwned(t *testing.T) {
+	startDBusClient(t, false)
+
+	// A second instance must not replace the running one
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply, err := conn.RequestName(dbusBusName, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatalf("RequestName: %v", err)
+	} else if reply == dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("%v was taken from the running client", dbusBusName)
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// templateFuncs returns the functions available to the templates in the
+// configuration file, such as waybar blocks and notification rules.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"toFahrenheit": func(t embermug.Temperature) int {
+			return int(t.Fahrenheit())
+		},
+		"toCelsius": func(t embermug.Temperature) int {
+			return int(t.Celsius())
+		},
+		"eta":      formatETA,
+		"duration": formatDuration,
+		"ordinal":  formatOrdinal,
+	}
+}
+
+// formatTemperature formats a temperature in both fahrenheit and celsius
+func formatTemperature(t embermug.Temperature) string {
+	return fmt.Sprintf("%.1fF (%.1fC)", t.Fahrenheit(), t.Celsius())
+}
+
+// formatETA formats an estimated duration for display (e.g. "~3 min"). An
+// empty string is returned if there is no estimate.
+func formatETA(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d < time.Minute:
+		return "<1 min"
+	default:
+		return fmt.Sprintf("~%d min", int(d.Round(time.Minute)/time.Minute))
+	}
+}
+
+// formatDuration formats a longer estimated duration for display (e.g. "2h 05m").
+// An empty string is returned if there is no estimate.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Round(time.Minute)/time.Minute))
+	default:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh %02dm", int(d/time.Hour), int((d%time.Hour)/time.Minute))
+	}
+}
+
+// formatOrdinal formats a count as an ordinal number (e.g. "3rd")
+func formatOrdinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return fmt.Sprintf("%dth", n)
+	case n%10 == 1:
+		return fmt.Sprintf("%dst", n)
+	case n%10 == 2:
+		return fmt.Sprintf("%dnd", n)
+	case n%10 == 3:
+		return fmt.Sprintf("%drd", n)
+	default:
+		return fmt.Sprintf("%dth", n)
+	}
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/calebstewart/go-embermug/history"
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/spf13/cobra"
+)
+
+var historyCommand = cobra.Command{
+	Use:   "history",
+	Short: "Query recorded Ember Mug telemetry",
+	Long: `Query recorded Ember Mug telemetry
+
+When history recording is enabled in the service configuration, every state
+change is recorded under $XDG_STATE_HOME/embermug/history. This command
+reads the recorded history for the given time range, and writes it to
+standard output in CSV or JSON format.
+
+The --since and --until flags accept either an RFC3339 timestamp, a date
+(YYYY-MM-DD) or a duration relative to now (e.g. '24h').
+`,
+	Args: cobra.ExactArgs(0),
+	Run:  commandExitWrapper(historyEntrypoint),
+}
+
+func init() {
+	flags := historyCommand.Flags()
+	flags.String("since", "", "Only show records observed at or after this time")
+	flags.String("until", "", "Only show records observed before this time")
+	flags.String("format", "csv", "Output format (csv or json)")
+
+	rootCmd.AddCommand(&historyCommand)
+}
+
+// historyDirectory returns the directory where history files are stored
+func historyDirectory() string {
+	return filepath.Join(xdg.StateHome, "embermug", "history")
+}
+
+// parseTimeArgument parses an absolute timestamp, a date, or a duration
+// relative to now. An empty string returns the zero time.
+func parseTimeArgument(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	} else if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	} else if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	} else {
+		return time.Time{}, fmt.Errorf("invalid time: %q", value)
+	}
+}
+
+func historyEntrypoint(cmd *cobra.Command, args []string) error {
+	var (
+		flags  = cmd.Flags()
+		now    = time.Now()
+		format = flags.Lookup("format").Value.String()
+	)
+
+	since, err := parseTimeArgument(flags.Lookup("since").Value.String(), now)
+	if err != nil {
+		slog.Error("Invalid start time", "Error", err)
+		return err
+	}
+
+	until, err := parseTimeArgument(flags.Lookup("until").Value.String(), now)
+	if err != nil {
+		slog.Error("Invalid end time", "Error", err)
+		return err
+	}
+
+	switch format {
+	case "csv":
+		err = writeHistoryCSV(os.Stdout, history.Query(historyDirectory(), since, until))
+	case "json":
+		err = writeHistoryJSON(os.Stdout, history.Query(historyDirectory(), since, until))
+	default:
+		err = fmt.Errorf("unknown output format: %q", format)
+	}
+
+	if err != nil {
+		slog.Error("Could not export history", "Error", err)
+		return err
+	}
+
+	return nil
+}
+
+// writeHistoryCSV writes the records as CSV with a header row. Temperatures
+// are written in degrees celsius.
+func writeHistoryCSV(stream io.Writer, records iter.Seq2[history.Record, error]) error {
+	var writer = csv.NewWriter(stream)
+
+	writer.Write([]string{
+		"time",
+		"connected",
+		"state",
+		"has_liquid",
+		"current_c",
+		"target_c",
+		"battery_charge",
+		"battery_charging",
+		"battery_temperature_c",
+	})
+
+	for record, err := range records {
+		if err != nil {
+			return err
+		}
+
+		writer.Write([]string{
+			record.Time.Format(time.RFC3339),
+			strconv.FormatBool(record.State.Connected),
+			record.State.State.String(),
+			strconv.FormatBool(record.State.HasLiquid),
+			strconv.FormatFloat(record.State.Current.Celsius(), 'f', 2, 64),
+			strconv.FormatFloat(record.State.Target.Celsius(), 'f', 2, 64),
+			strconv.Itoa(record.State.Battery.Charge),
+			strconv.FormatBool(record.State.Battery.Charging),
+			strconv.FormatFloat(record.State.Battery.Temperature.Celsius(), 'f', 2, 64),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeHistoryJSON writes the records as a single JSON array
+func writeHistoryJSON(stream io.Writer, records iter.Seq2[history.Record, error]) error {
+	var result = []history.Record{}
+
+	for record, err := range records {
+		if err != nil {
+			return err
+		}
+		result = append(result, record)
+	}
+
+	encoder := json.NewEncoder(stream)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// historyClient records every state change from the service in the history store
+func historyClient(client *service.Client, store *history.Store) {
+	var (
+		lastState service.State
+		logger    = slog.With("ClientID", client.ID)
+	)
+	defer store.Close()
+
+	logger.Info("History Recorder Started", "Directory", historyDirectory())
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			} else if state == lastState {
+				continue
+			}
+
+			if err := store.Append(history.Record{
+				Time:  time.Now(),
+				State: state,
+			}); err != nil {
+				logger.Error("Could not record mug state", "Error", err)
+			}
+
+			lastState = state
+		}
+	}
+}
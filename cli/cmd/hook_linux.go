@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/calebstewart/go-embermug/service"
+)
+
+const (
+	defaultHookTimeout = 30 * time.Second
+
+	// hookWaitDelay is how long to wait for the output of a hook to close
+	// after the hook exits or is killed. Background processes started by a
+	// hook may otherwise hold the output open indefinitely.
+	hookWaitDelay = 5 * time.Second
+
+	// hookQueueSize is the number of hooks which may wait for a free worker.
+	// Further hooks are dropped until the queue drains, so slow hooks cannot
+	// pile up without limit.
+	hookQueueSize = 32
+)
+
+// hookJob is a hook waiting to run for a transition
+type hookJob struct {
+	hook       HookConfig
+	transition Transition
+	state      service.State
+}
+
+var ErrInvalidHook = errors.New("hook must define a command and at least one transition")
+
+// validateHooks checks the hook configuration, and fills in default timeouts
+func validateHooks(hooks []HookConfig) error {
+	for index := range hooks {
+		var hook = &hooks[index]
+
+		if hook.Command == "" || len(hook.On) == 0 {
+			return fmt.Errorf("hook %v: %w", index, ErrInvalidHook)
+		} else if err := validateTransitions(hook.On); err != nil {
+			return fmt.Errorf("hook %v: %w", index, err)
+		}
+
+		if hook.Timeout <= 0 {
+			hook.Timeout = defaultHookTimeout
+		}
+	}
+
+	return nil
+}
+
+// stateEnvironment returns the given state as a list of environment variables
+// for hook commands.
+func stateEnvironment(transition Transition, state service.State) []string {
+	var values = []struct {
+		name  string
+		value string
+	}{
+		{"TRANSITION", string(transition)},
+		{"CONNECTED", strconv.FormatBool(state.Connected)},
+		{"STATE", state.State.String()},
+		{"HAS_LIQUID", strconv.FormatBool(state.HasLiquid)},
+		{"CURRENT_C", strconv.FormatFloat(state.Current.Celsius(), 'f', 2, 64)},
+		{"CURRENT_F", strconv.FormatFloat(state.Current.Fahrenheit(), 'f', 2, 64)},
+		{"TARGET_C", strconv.FormatFloat(state.Target.Celsius(), 'f', 2, 64)},
+		{"TARGET_F", strconv.FormatFloat(state.Target.Fahrenheit(), 'f', 2, 64)},
+		{"BATTERY", strconv.Itoa(state.Battery.Charge)},
+		{"CHARGING", strconv.FormatBool(state.Battery.Charging)},
+		{"PRESET", state.Preset},
+		{"ETA", strconv.Itoa(int(state.ETA.Seconds()))},
+		{"TIME_TO_EMPTY", strconv.Itoa(int(state.TimeToEmpty.Seconds()))},
+		{"TIME_TO_FULL", strconv.Itoa(int(state.TimeToFull.Seconds()))},
+	}
+
+	var env = make([]string, 0, len(values))
+	for _, v := range values {
+		env = append(env, "EMBERMUG_"+v.name+"="+v.value)
+	}
+
+	return env
+}
+
+// hookWorker runs queued hooks one at a time until the context is cancelled
+func hookWorker(ctx context.Context, logger *slog.Logger, jobs <-chan hookJob) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-jobs:
+			runHook(ctx, logger, job.hook, job.transition, job.state)
+		}
+	}
+}
+
+// runHook executes a single hook command for the given transition
+func runHook(ctx context.Context, logger *slog.Logger, hook HookConfig, transition Transition, state service.State) {
+	var (
+		stdin  bytes.Buffer
+		output bytes.Buffer
+	)
+
+	logger = logger.With("Transition", transition, "Command", hook.Command)
+
+	if err := json.NewEncoder(&stdin).Encode(state); err != nil {
+		logger.Error("Could not encode hook input", "Error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	// The hook runs in its own process group, so processes started by the
+	// shell are killed along with it when the timeout expires.
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook.Command)
+	cmd.Stdin = &stdin
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(), stateEnvironment(transition, state)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = hookWaitDelay
+
+	started := time.Now()
+	logger.Debug("Running hook")
+
+	if err := cmd.Run(); errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.Error("Hook timed out", "Timeout", hook.Timeout, "Output", output.String())
+	} else if err != nil {
+		logger.Error("Hook failed", "Error", err, "Output", output.String())
+	} else {
+		logger.Info("Hook completed", "Duration", time.Since(started), "Output", output.String())
+	}
+}
+
+// hookClient runs the configured hooks whenever the mug state transitions.
+// At most concurrency hooks run at once, and at most hookQueueSize hooks wait
+// to run. Hooks for transitions beyond that are dropped.
+func hookClient(client *service.Client, hooks []HookConfig, concurrency int, lowBattery int) {
+	var (
+		lastState service.State
+		logger    = slog.With("ClientID", client.ID)
+		jobs      = make(chan hookJob, hookQueueSize)
+	)
+
+	logger.Info("Hook Client Started", "Hooks", len(hooks))
+
+	for range max(concurrency, 1) {
+		go hookWorker(client.Context, logger, jobs)
+	}
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			for _, transition := range detectTransitions(lastState, state, lowBattery) {
+				for _, hook := range hooks {
+					if !slices.Contains(hook.On, transition) {
+						continue
+					}
+
+					select {
+					case jobs <- hookJob{hook: hook, transition: transition, state: state}:
+					default:
+						logger.Warn("Hook queue is full. Dropping hook.", "Transition", transition, "Command", hook.Command)
+					}
+				}
+			}
+
+			lastState = state
+		}
+	}
+}
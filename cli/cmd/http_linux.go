@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// httpShutdownTimeout is how long HTTP servers wait for active requests
+	// when the service stops.
+	httpShutdownTimeout = 5 * time.Second
+
+	// httpReadHeaderTimeout limits how long clients may take to send the
+	// request headers.
+	httpReadHeaderTimeout = 10 * time.Second
+
+	// httpMaxBodySize limits the size of request bodies
+	httpMaxBodySize = 64 * 1024
+
+	// eventStreamKeepAlive is how often a comment is sent on idle event
+	// streams, so proxies and clients do not time out the connection.
+	eventStreamKeepAlive = 30 * time.Second
+)
+
+var (
+	ErrInvalidRequestBody = errors.New("invalid request body")
+	ErrHTTPAuthRequired   = errors.New("HTTP API listeners on non-loopback addresses require a token")
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// httpAPI serves the REST API and Server-Sent Events stream
+type httpAPI struct {
+	svc        *service.Service
+	token      string // Bearer token required for all requests (empty disables authentication)
+	lowBattery int    // Battery percentage for the 'battery-low' transition
+}
+
+// stateChange is the payload of the 'change' event on the event stream
+type stateChange struct {
+	Transitions []Transition              // Transitions between the previous and current state
+	Changes     map[string]service.Change // State fields which changed
+}
+
+// targetRequest is the body of 'POST /target'
+type targetRequest struct {
+	Fahrenheit float64
+	Celsius    float64
+}
+
+// colorRequest is the body of 'POST /color'
+type colorRequest struct {
+	Color string // '#RRGGBB' or '#RRGGBBAA'
+}
+
+// nameRequest is the body of 'POST /name'
+type nameRequest struct {
+	Name string
+}
+
+// presetRequest is the body of 'POST /preset'
+type presetRequest struct {
+	Preset string
+}
+
+// errorResponse is the body of all failed requests
+type errorResponse struct {
+	Error string
+}
+
+// Handler returns the HTTP handler for the API
+func (a *httpAPI) Handler() http.Handler {
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+	})
+
+	mux.Handle("GET /", dashboardHandler())
+	mux.Handle("GET /state", a.authenticated(a.getState))
+	mux.Handle("GET /events", a.authenticated(a.getEvents))
+	mux.Handle("GET /history", a.authenticated(a.getHistory))
+	mux.Handle("GET /ws", a.authenticated(a.getWebSocket))
+	mux.Handle("POST /target", a.authenticated(command(a, func(body targetRequest) (msg service.Message, err error) {
+		preset, err := (PresetConfig{Fahrenheit: body.Fahrenheit, Celsius: body.Celsius}).Preset("")
+		msg.SetTarget = preset.Target
+		return msg, err
+	})))
+	mux.Handle("POST /color", a.authenticated(command(a, func(body colorRequest) (msg service.Message, err error) {
+		color, err := parseColor(body.Color)
+		msg.SetColor = &color
+		return msg, err
+	})))
+	mux.Handle("POST /name", a.authenticated(command(a, func(body nameRequest) (msg service.Message, err error) {
+		if body.Name == "" {
+			return msg, fmt.Errorf("%w: name must not be empty", ErrInvalidRequestBody)
+		}
+		msg.SetName = body.Name
+		return msg, nil
+	})))
+	mux.Handle("POST /preset", a.authenticated(command(a, func(body presetRequest) (msg service.Message, err error) {
+		if body.Preset == "" {
+			return msg, fmt.Errorf("%w: preset must not be empty", ErrInvalidRequestBody)
+		}
+		msg.ApplyPreset = body.Preset
+		return msg, nil
+	})))
+	mux.Handle("POST /reconnect", a.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		a.execute(w, service.Message{Reconnect: true})
+	}))
+
+	return mux
+}
+
+// authenticated wraps the handler with bearer token authentication. The token
+// is never accepted in the URL, since URLs end up in logs and browser history.
+func (a *httpAPI) authenticated(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.token != "" {
+			token, ok := requestToken(r)
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="embermug"`)
+				writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+				return
+			}
+		}
+
+		handler(w, r)
+	})
+}
+
+// requestToken returns the bearer token from the Authorization header. Browsers
+// cannot set headers on WebSocket connections, so the token may instead be
+// requested as a subprotocol (see [websocketTokenProtocol]).
+func requestToken(r *http.Request) (string, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token, true
+	}
+
+	for _, protocol := range websocket.Subprotocols(r) {
+		if encoded, ok := strings.CutPrefix(protocol, websocketTokenProtocol); ok {
+			if token, err := base64.RawURLEncoding.DecodeString(encoded); err == nil {
+				return string(token), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// loopbackListener returns true if the listener only accepts connections
+// from this host.
+func loopbackListener(listener net.Listener) bool {
+	addr, ok := listener.Addr().(*net.TCPAddr)
+	return ok && addr.IP.IsLoopback()
+}
+
+// command returns a handler which decodes the JSON request body, converts it
+// into a service message with the given function, and executes it.
+func command[T any](a *httpAPI, convert func(body T) (service.Message, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body T
+
+		if err := json.NewDecoder(io.LimitReader(r.Body, httpMaxBodySize)).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("%v: %v", ErrInvalidRequestBody, err)})
+		} else if msg, err := convert(body); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		} else {
+			a.execute(w, msg)
+		}
+	}
+}
+
+// execute runs the message, and responds with either the resulting state
+// or the error.
+func (a *httpAPI) execute(w http.ResponseWriter, msg service.Message) {
+	if err := a.svc.HandleMessage(msg); err != nil {
+		writeJSON(w, commandErrorStatus(err), errorResponse{Error: err.Error()})
+	} else {
+		writeJSON(w, http.StatusOK, a.svc.State())
+	}
+}
+
+// commandErrorStatus returns the HTTP status code for a failed command
+func commandErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotConnected):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, service.ErrTargetOutOfRange),
+		errors.Is(err, service.ErrUnknownPreset),
+		errors.Is(err, embermug.ErrNameTooLong):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// getState responds with the current state
+func (a *httpAPI) getState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.svc.State())
+}
+
+// getEvents streams the state as Server-Sent Events. A 'state' event carries
+// every new state, and is followed by a 'change' event describing the
+// difference from the previous state.
+func (a *httpAPI) getEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "streaming is not supported"})
+		return
+	}
+
+	var (
+		client    = a.svc.RegisterClient(r.Context())
+		lastState = a.svc.State()
+		ticker    = time.NewTicker(eventStreamKeepAlive)
+		logger    = slog.With("ClientID", client.ID, "RemoteAddr", r.RemoteAddr)
+	)
+	defer ticker.Stop()
+	defer client.Cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	logger.Debug("Event stream client connected")
+	defer logger.Debug("Event stream client disconnected")
+
+	if err := writeEvent(w, "state", lastState); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			if err := writeEvent(w, "state", state); err != nil {
+				return
+			}
+
+			if changes := state.Diff(lastState); len(changes) > 0 {
+				if err := writeEvent(w, "change", stateChange{
+					Transitions: detectTransitions(lastState, state, a.lowBattery),
+					Changes:     changes,
+				}); err != nil {
+					return
+				}
+			}
+
+			lastState = state
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON payload
+func writeEvent(w io.Writer, event string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %v\ndata: %s\n\n", event, data)
+	return err
+}
+
+// writeJSON responds with the given status code and JSON body
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Debug("Could not write HTTP response", "Error", err)
+	}
+}
+
+// serveHTTP runs the HTTP server on the listener until the context is
+// cancelled, and then shuts it down gracefully.
+func serveHTTP(ctx context.Context, server *http.Server, listener net.Listener, name string) {
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Starting HTTP server", "Server", name, "Addr", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP server failed", "Server", name, "Addr", listener.Addr(), "Error", err)
+	}
+}
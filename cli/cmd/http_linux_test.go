@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/gorilla/websocket"
+	"tinygo.org/x/bluetooth"
+)
+
+func TestHTTPAuthentication(t *testing.T) {
+	const token = "s3cret/token+"
+
+	var encoded = websocketTokenProtocol + base64.RawURLEncoding.EncodeToString([]byte(token))
+
+	tests := []struct {
+		name     string
+		token    string // Configured token
+		target   string
+		header   http.Header
+		expected int
+	}{
+		{name: "disabled", target: "/state", expected: http.StatusOK},
+		{name: "missing", token: token, target: "/state", expected: http.StatusUnauthorized},
+		{name: "bearer", token: token, target: "/state", header: http.Header{"Authorization": {"Bearer " + token}}, expected: http.StatusOK},
+		{name: "wrong bearer", token: token, target: "/state", header: http.Header{"Authorization": {"Bearer nope"}}, expected: http.StatusUnauthorized},
+		{name: "basic", token: token, target: "/state", header: http.Header{"Authorization": {"Basic " + token}}, expected: http.StatusUnauthorized},
+		{name: "query", token: token, target: "/state?token=" + token, expected: http.StatusUnauthorized},
+		{name: "query command", token: token, target: "/reconnect?token=" + token, expected: http.StatusUnauthorized},
+		{name: "subprotocol", token: token, target: "/state", header: http.Header{"Sec-Websocket-Protocol": {websocketProtocol + ", " + encoded}}, expected: http.StatusOK},
+		{name: "wrong subprotocol", token: token, target: "/state", header: http.Header{"Sec-Websocket-Protocol": {websocketTokenProtocol + "bm9wZQ"}}, expected: http.StatusUnauthorized},
+		{name: "dashboard", token: token, target: "/", expected: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				api      = &httpAPI{svc: service.New(nil, bluetooth.Address{}), token: test.token}
+				method   = http.MethodGet
+				recorder = httptest.NewRecorder()
+			)
+			if strings.HasPrefix(test.target, "/reconnect") {
+				method = http.MethodPost
+			}
+
+			request := httptest.NewRequest(method, test.target, nil)
+			for name, values := range test.header {
+				request.Header[name] = values
+			}
+
+			api.Handler().ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expected {
+				t.Errorf("status = %v, expected %v", recorder.Code, test.expected)
+			}
+			if recorder.Code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestHTTPWebSocketToken(t *testing.T) {
+	const token = "s3cret"
+
+	server := httptest.NewServer((&httpAPI{svc: service.New(nil, bluetooth.Address{}), token: token}).Handler())
+	defer server.Close()
+
+	var url = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	// Without the token, the upgrade is refused
+	if conn, response, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		conn.Close()
+		t.Fatal("connected without a token")
+	} else if response == nil || response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{
+		websocketProtocol,
+		websocketTokenProtocol + base64.RawURLEncoding.EncodeToString([]byte(token)),
+	}}
+
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	// The token is never echoed back as the selected subprotocol
+	if protocol := conn.Subprotocol(); protocol != websocketProtocol {
+		t.Errorf("subprotocol = %q, expected %q", protocol, websocketProtocol)
+	}
+}
+
+func TestLoopbackListener(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:0": true,
+		"localhost:0": true,
+		"0.0.0.0:0":   false,
+		":0":          false,
+	}
+
+	for address, expected := range tests {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Errorf("Listen(%q): %v", address, err)
+			continue
+		}
+
+		if loopback := loopbackListener(listener); loopback != expected {
+			t.Errorf("loopbackListener(%q) = %v, expected %v", address, loopback, expected)
+		}
+		listener.Close()
+	}
+}
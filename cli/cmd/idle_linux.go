@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// socketActivated returns whether the service was started by systemd socket
+// activation. This must be checked before the activated sockets are opened,
+// since that clears the environment.
+func socketActivated() bool {
+	return os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) && os.Getenv("LISTEN_FDS") != ""
+}
+
+// idleExitBlockers returns the names of the enabled features which need the
+// service running without socket clients, and so prevent an idle exit. This
+// includes listeners opened by the service rather than by systemd, since
+// nothing starts the service again for their clients.
+func idleExitBlockers(cfg *ServiceConfig) []string {
+	var blockers []string
+
+	if cfg.EnableNotifications {
+		blockers = append(blockers, "notifications")
+	}
+	if cfg.History.Enabled {
+		blockers = append(blockers, "history")
+	}
+	if len(cfg.Schedule) > 0 {
+		blockers = append(blockers, "schedule")
+	}
+	if len(cfg.Hooks) > 0 {
+		blockers = append(blockers, "hooks")
+	}
+	if len(cfg.Webhooks) > 0 {
+		blockers = append(blockers, "webhooks")
+	}
+	if cfg.MQTT.Broker != "" {
+		blockers = append(blockers, "mqtt")
+	}
+	if cfg.EnableDBus {
+		blockers = append(blockers, "dbus")
+	}
+	if cfg.Metrics.Listen != "" {
+		blockers = append(blockers, "metrics")
+	}
+	if cfg.HTTP.Listen != "" {
+		blockers = append(blockers, "http")
+	}
+	for _, listener := range cfg.Listeners {
+		if listener.Address != "" {
+			blockers = append(blockers, "listener "+listener.Address)
+		}
+	}
+
+	return blockers
+}
+
+// idleExitEnabled returns whether the service may exit once idle. An idle
+// exit is only safe when systemd will start the service again for the next
+// socket client, and when no integration or listener relies on the service
+// running.
+func idleExitEnabled(cfg *ServiceConfig) bool {
+	if cfg.IdleExit <= 0 {
+		return false
+	}
+
+	if !socketActivated() {
+		slog.Warn("Idle exit requires socket activation. Idle Exit Disabled.", "IdleExit", cfg.IdleExit)
+		return false
+	}
+
+	if blockers := idleExitBlockers(cfg); len(blockers) > 0 {
+		slog.Warn("Enabled features need the service running. Idle Exit Disabled.", "IdleExit", cfg.IdleExit, "Enabled", blockers)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var infoCommand = cobra.Command{
+	Use:   "info",
+	Short: "Show the current Ember Mug state",
+	Long: `Show the current Ember Mug state
+
+This command connects to the embermug service socket, prints a summary of
+the current mug state including battery estimates, and exits.
+`,
+	Args: cobra.ExactArgs(0),
+	Run:  commandExitWrapper(infoEntrypoint),
+}
+
+func init() {
+	rootCmd.AddCommand(&infoCommand)
+}
+
+func infoEntrypoint(cmd *cobra.Command, args []string) error {
+	var (
+		cfg   Config
+		state service.State
+	)
+
+	if err := viper.Unmarshal(&cfg); err != nil {
+		slog.Error("Invalid configuration", "Error", err)
+		return err
+	}
+
+	conn, err := dialService(&cfg)
+	if err != nil {
+		slog.Error("Could not connect to service", "Address", cfg.SocketPath, "Error", err)
+		return err
+	}
+	defer conn.Close()
+
+	if err := json.NewDecoder(conn).Decode(&state); err != nil {
+		slog.Error("Could not decode state", "Error", err)
+		return err
+	}
+
+	writeStateInfo(os.Stdout, state)
+	return nil
+}
+
+// writeStateInfo writes a human readable summary of the given state
+func writeStateInfo(stream io.Writer, state service.State) {
+	var writer = tabwriter.NewWriter(stream, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	if !state.Connected {
+		fmt.Fprintf(writer, "Connected:\tno\n")
+		return
+	}
+
+	fmt.Fprintf(writer, "Connected:\tyes\n")
+	fmt.Fprintf(writer, "State:\t%v\n", state.State)
+	fmt.Fprintf(writer, "Has Liquid:\t%v\n", state.HasLiquid)
+	fmt.Fprintf(writer, "Current:\t%v\n", formatTemperature(state.Current))
+	fmt.Fprintf(writer, "Target:\t%v\n", formatTemperature(state.Target))
+	if state.Preset != "" {
+		fmt.Fprintf(writer, "Preset:\t%v\n", state.Preset)
+	}
+	if !state.NextChange.Time.IsZero() {
+		fmt.Fprintf(writer, "Next Change:\t%v at %v\n", formatTemperature(state.NextChange.Target), state.NextChange.Time.Local().Format(time.DateTime))
+	}
+	if state.ETA > 0 {
+		fmt.Fprintf(writer, "Ready In:\t%v\n", formatETA(state.ETA))
+	}
+
+	if state.ClockDrift != 0 {
+		fmt.Fprintf(writer, "Clock Drift:\t%v\n", state.ClockDrift)
+	}
+
+	if state.Battery.Charging {
+		fmt.Fprintf(writer, "Battery:\t%v%% (charging)\n", state.Battery.Charge)
+	} else {
+		fmt.Fprintf(writer, "Battery:\t%v%% (discharging)\n", state.Battery.Charge)
+	}
+	fmt.Fprintf(writer, "Battery Temperature:\t%v\n", formatTemperature(state.Battery.Temperature))
+
+	if state.TimeToEmpty > 0 {
+		fmt.Fprintf(writer, "Time to Empty:\t%v\n", formatDuration(state.TimeToEmpty))
+	}
+	if state.TimeToFull > 0 {
+		fmt.Fprintf(writer, "Time to Full:\t%v\n", formatDuration(state.TimeToFull))
+	}
+}
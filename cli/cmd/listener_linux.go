@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/coreos/go-systemd/v22/activation"
+)
+
+var (
+	ErrListenerAddress        = errors.New("listener must define exactly one of 'address' or 'name'")
+	ErrRemoteAuthRequired     = errors.New("TCP listeners require a token or a client CA (configure activated TCP sockets by name)")
+	ErrTLSCertRequired        = errors.New("TLS listeners require a certificate and key")
+	ErrTLSOptionsWithoutTLS   = errors.New("TLS options require a 'tls://' address")
+	ErrUnixListenerAuth       = errors.New("unix listeners do not support tokens or TLS (use access rules)")
+	ErrActivatedSocketOptions = errors.New("the mode and group of activated sockets are set by the socket unit")
+	ErrSocketOptionsWithTCP   = errors.New("mode and group only apply to unix sockets")
+)
+
+// serviceListeners opens every socket the service accepts clients on. All
+// systemd activated sockets are served, and the default socket at the socket
+// path is only opened without socket activation. Configured listeners are
+// opened in addition to these. Listeners are closed if any of them fails.
+func serviceListeners(cfg *Config) (listeners []service.Listener, err error) {
+	defer func() {
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			listeners = nil
+		}
+	}()
+
+	activated, err := activation.ListenersWithNames()
+	if err != nil {
+		return nil, fmt.Errorf("could not find systemd activation listeners: %w", err)
+	}
+
+	// The socket unit creates activated sockets, so the options for the
+	// default socket cannot apply to them.
+	if len(activated) > 0 && (cfg.Service.SocketMode != "" || cfg.Service.SocketGroup != "") {
+		return nil, fmt.Errorf("service.socket-mode and service.socket-group: %w", ErrActivatedSocketOptions)
+	}
+
+	var named = make(map[string]ListenerConfig)
+	for _, listenerCfg := range cfg.Service.Listeners {
+		if (listenerCfg.Address == "") == (listenerCfg.Name == "") {
+			return nil, ErrListenerAddress
+		} else if listenerCfg.Name != "" {
+			named[listenerCfg.Name] = listenerCfg
+		}
+	}
+
+	for name, sockets := range activated {
+		listenerCfg := named[name]
+		if listenerCfg.Mode != "" || listenerCfg.Group != "" {
+			return listeners, fmt.Errorf("socket %q: %w", name, ErrActivatedSocketOptions)
+		}
+		delete(named, name)
+
+		for _, socket := range sockets {
+			listener, err := configureListener(socket, listenerCfg, listenerCfg.Cert != "")
+			if err != nil {
+				return listeners, fmt.Errorf("socket %q: %w", name, err)
+			}
+
+			slog.Info("Received SystemD Activation Listener", "Name", name, "Addr", socket.Addr(), "ReadOnly", listener.ReadOnly)
+			listeners = append(listeners, listener)
+		}
+	}
+
+	for name := range named {
+		slog.Warn("Configured systemd socket was not activated", "Name", name)
+	}
+
+	if len(activated) == 0 {
+		path, err := unixSocketPath(cfg.SocketPath)
+		if err != nil {
+			return listeners, err
+		}
+
+		options, err := parseSocketOptions(cfg.Service.SocketMode, cfg.Service.SocketGroup)
+		if err != nil {
+			return listeners, err
+		}
+
+		slog.Warn("No systemd sockets found")
+		slog.Warn("Listening on default socket path", "Path", path)
+
+		socket, err := listenUnixSocket(path, options)
+		if err != nil {
+			return listeners, fmt.Errorf("could not open unix socket %q: %w", path, err)
+		}
+		listeners = append(listeners, service.Listener{Listener: socket})
+	}
+
+	for _, listenerCfg := range cfg.Service.Listeners {
+		if listenerCfg.Address == "" {
+			continue
+		}
+
+		listener, err := openListener(listenerCfg)
+		if err != nil {
+			return listeners, fmt.Errorf("listener %q: %w", listenerCfg.Address, err)
+		}
+
+		slog.Info("Opened listener", "Address", listenerCfg.Address, "ReadOnly", listener.ReadOnly)
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// openListener opens the socket at the configured address. The configuration
+// is validated before the socket is opened.
+func openListener(cfg ListenerConfig) (service.Listener, error) {
+	scheme, addr, err := parseSocketAddress(cfg.Address)
+	if err != nil {
+		return service.Listener{}, err
+	}
+
+	var socket net.Listener
+
+	switch scheme {
+	case schemeUnix:
+		if cfg.Token != "" || cfg.Cert != "" || cfg.Key != "" || cfg.ClientCA != "" {
+			return service.Listener{}, ErrUnixListenerAuth
+		}
+
+		options, err := parseSocketOptions(cfg.Mode, cfg.Group)
+		if err != nil {
+			return service.Listener{}, err
+		}
+
+		// Validate the role before a stale socket is removed
+		if _, err := listenerRole(cfg.Role); err != nil {
+			return service.Listener{}, err
+		}
+
+		if socket, err = listenUnixSocket(addr, options); err != nil {
+			return service.Listener{}, err
+		}
+	default:
+		if cfg.Mode != "" || cfg.Group != "" {
+			return service.Listener{}, ErrSocketOptionsWithTCP
+		} else if scheme == schemeTCP && (cfg.Cert != "" || cfg.Key != "" || cfg.ClientCA != "") {
+			return service.Listener{}, ErrTLSOptionsWithoutTLS
+		} else if cfg.Token == "" && cfg.ClientCA == "" {
+			return service.Listener{}, ErrRemoteAuthRequired
+		}
+
+		if socket, err = net.Listen("tcp", addr); err != nil {
+			return service.Listener{}, err
+		}
+	}
+
+	listener, err := configureListener(socket, cfg, scheme == schemeTLS)
+	if err != nil {
+		socket.Close()
+	}
+
+	return listener, err
+}
+
+// configureListener applies the role and authentication of the configuration
+// to an open socket. TCP sockets are wrapped with TLS if useTLS is true.
+func configureListener(socket net.Listener, cfg ListenerConfig, useTLS bool) (service.Listener, error) {
+	var listener = service.Listener{Listener: socket}
+
+	role, err := listenerRole(cfg.Role)
+	if err != nil {
+		return listener, err
+	}
+	listener.ReadOnly = role == service.RoleReadOnly
+
+	// Unix socket clients are authorized by the access rules
+	if socket.Addr().Network() == "unix" {
+		if cfg.Token != "" || cfg.Cert != "" || cfg.Key != "" || cfg.ClientCA != "" {
+			return listener, ErrUnixListenerAuth
+		}
+		return listener, nil
+	}
+
+	if useTLS {
+		if cfg.Cert == "" || cfg.Key == "" {
+			return listener, ErrTLSCertRequired
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return listener, err
+		}
+
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+		if cfg.ClientCA != "" {
+			if tlsConfig.ClientCAs, err = loadCertPool(cfg.ClientCA); err != nil {
+				return listener, err
+			}
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		listener.Listener = tls.NewListener(socket, tlsConfig)
+	}
+
+	// Activated sockets are not checked before they are opened, so the
+	// authentication is also enforced here.
+	if cfg.Token == "" && cfg.ClientCA == "" {
+		return listener, ErrRemoteAuthRequired
+	} else if !useTLS {
+		slog.Warn("Listener does not use TLS. The token and mug state are sent unencrypted.", "Addr", socket.Addr())
+	}
+
+	listener.Handshake = remoteHandshake(cfg.Token)
+
+	return listener, nil
+}
+
+// listenerRole parses the role of a listener, which defaults to control
+func listenerRole(name string) (service.Role, error) {
+	if name == "" {
+		return service.RoleControl, nil
+	}
+	return service.ParseRole(name)
+}
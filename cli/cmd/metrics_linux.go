@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+const (
+	metricsContentType     = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// metricFamily is a single metric with all of its samples
+type metricFamily struct {
+	name    string // Metric name (without the '_total' suffix for counters)
+	help    string
+	kind    string // 'gauge' or 'counter'
+	samples []metricSample
+}
+
+// metricSample is a single value of a metric family
+type metricSample struct {
+	labels []string // Alternating label names and values
+	value  float64
+}
+
+// gauge creates a gauge family with a single unlabeled sample
+func gauge(name, help string, value float64) metricFamily {
+	return metricFamily{name: name, help: help, kind: "gauge", samples: []metricSample{{value: value}}}
+}
+
+// counter creates a counter family with a single unlabeled sample
+func counter(name, help string, value uint64) metricFamily {
+	return metricFamily{name: name, help: help, kind: "counter", samples: []metricSample{{value: float64(value)}}}
+}
+
+// boolValue converts a boolean into a gauge value
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// collectMetrics builds the metric families from the service state and counters
+func collectMetrics(state service.State, counters service.Metrics) []metricFamily {
+	var families = []metricFamily{
+		gauge("embermug_connected", "Whether the mug is connected.", boolValue(state.Connected)),
+	}
+
+	if state.Connected {
+		families = append(families,
+			gauge("embermug_current_temperature_celsius", "Current liquid temperature.", state.Current.Celsius()),
+			gauge("embermug_target_temperature_celsius", "Target liquid temperature.", state.Target.Celsius()),
+			gauge("embermug_battery_charge_percent", "Battery charge.", float64(state.Battery.Charge)),
+			gauge("embermug_battery_temperature_celsius", "Battery temperature.", state.Battery.Temperature.Celsius()),
+			gauge("embermug_battery_charging", "Whether the mug is charging.", boolValue(state.Battery.Charging)),
+			gauge("embermug_liquid_present", "Whether the mug contains liquid.", boolValue(state.HasLiquid)),
+			gauge("embermug_eta_seconds", "Estimated time until the liquid reaches the target (0 if unknown).", state.ETA.Seconds()),
+		)
+
+		var liquidState = metricFamily{name: "embermug_state", help: "Liquid state of the mug.", kind: "gauge"}
+		for s := embermug.StateEmpty; s <= embermug.StateStable; s++ {
+			liquidState.samples = append(liquidState.samples, metricSample{
+				labels: []string{"state", s.String()},
+				value:  boolValue(state.State == s),
+			})
+		}
+		families = append(families, liquidState)
+	}
+
+	var events = metricFamily{name: "embermug_events", help: "Mug events received, by event type.", kind: "counter"}
+	for event := embermug.EventRefreshBattery; event <= embermug.EventRefreshState; event++ {
+		events.samples = append(events.samples, metricSample{
+			labels: []string{"event", event.String()},
+			value:  float64(counters.Events[event]),
+		})
+	}
+
+	var commands = metricFamily{name: "embermug_commands", help: "Executed commands, by command and result.", kind: "counter"}
+	for _, command := range []string{
+		service.CommandReconnect,
+		service.CommandApplyPreset,
+		service.CommandSetTarget,
+		service.CommandAdjustTarget,
+		service.CommandSetColor,
+		service.CommandSetName,
+	} {
+		for _, success := range []bool{true, false} {
+			var result = "failure"
+			if success {
+				result = "success"
+			}
+
+			commands.samples = append(commands.samples, metricSample{
+				labels: []string{"command", command, "result", result},
+				value:  float64(counters.Commands[service.CommandOutcome{Command: command, Success: success}]),
+			})
+		}
+	}
+
+	return append(families,
+		events,
+		counter("embermug_connect_attempts", "Bluetooth connection attempts.", counters.ConnectAttempts),
+		counter("embermug_connect_failures", "Failed bluetooth connection attempts.", counters.ConnectFailures),
+		gauge("embermug_clients", "Currently registered clients, including integrations.", float64(counters.Clients)),
+		counter("embermug_client_registrations", "Clients registered since the service started.", counters.ClientsTotal),
+		counter("embermug_dropped_updates", "State updates dropped because a client was not keeping up.", counters.DroppedUpdates),
+		commands,
+	)
+}
+
+var (
+	labelEscaper       = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`) // Escapes label values in both formats
+	helpEscaper        = strings.NewReplacer(`\`, `\\`, "\n", `\n`)            // Escapes help text in the Prometheus text format
+	openMetricsEscaper = labelEscaper                                          // Escapes help text in the OpenMetrics format
+)
+
+// writeMetrics writes the metric families in the Prometheus text exposition
+// format, or the OpenMetrics format if openMetrics is true.
+func writeMetrics(w io.Writer, families []metricFamily, openMetrics bool) error {
+	var buffer = bufio.NewWriter(w)
+
+	for _, family := range families {
+		var (
+			familyName = family.name
+			sampleName = family.name
+		)
+
+		// OpenMetrics names the counter family without the suffix, while the
+		// Prometheus text format uses the sample name for both.
+		if family.kind == "counter" {
+			sampleName += "_total"
+			if !openMetrics {
+				familyName = sampleName
+			}
+		}
+
+		var help = helpEscaper.Replace(family.help)
+		if openMetrics {
+			help = openMetricsEscaper.Replace(family.help)
+		}
+
+		fmt.Fprintf(buffer, "# HELP %v %v\n", familyName, help)
+		fmt.Fprintf(buffer, "# TYPE %v %v\n", familyName, family.kind)
+
+		for _, sample := range family.samples {
+			buffer.WriteString(sampleName)
+
+			if len(sample.labels) > 0 {
+				buffer.WriteByte('{')
+				for index := 0; index < len(sample.labels); index += 2 {
+					if index > 0 {
+						buffer.WriteByte(',')
+					}
+					fmt.Fprintf(buffer, `%v="%v"`, sample.labels[index], labelEscaper.Replace(sample.labels[index+1]))
+				}
+				buffer.WriteByte('}')
+			}
+
+			buffer.WriteByte(' ')
+			buffer.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+			buffer.WriteByte('\n')
+		}
+	}
+
+	if openMetrics {
+		buffer.WriteString("# EOF\n")
+	}
+
+	return buffer.Flush()
+}
+
+// metricsHandler serves the service metrics
+func metricsHandler(svc *service.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			openMetrics = strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+			families    = collectMetrics(svc.State(), svc.Metrics())
+		)
+
+		if openMetrics {
+			w.Header().Set("Content-Type", openMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", metricsContentType)
+		}
+
+		if err := writeMetrics(w, families, openMetrics); err != nil {
+			slog.Debug("Could not write metrics", "Error", err)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	"tinygo.org/x/bluetooth"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	families := []metricFamily{
+		gauge("test_temperature", `Help with a \ backslash, "quotes" and a`+"\nnewline.", 57.5),
+		{
+			name: "test_requests",
+			help: "Requests by path.",
+			kind: "counter",
+			samples: []metricSample{
+				{labels: []string{"path", `C:\mug "one"` + "\n"}, value: 3},
+				{labels: []string{"path", "/", "method", "GET"}, value: 0},
+			},
+		},
+		gauge("test_unknown", "Not a number.", math.NaN()),
+	}
+
+	tests := []struct {
+		name        string
+		openMetrics bool
+		expected    string
+	}{
+		{
+			name: "prometheus",
+			expected: `# HELP test_temperature Help with a \\ backslash, "quotes" and a\nnewline.
+# TYPE test_temperature gauge
+test_temperature 57.5
+# HELP test_requests_total Requests by path.
+# TYPE test_requests_total counter
+test_requests_total{path="C:\\mug \"one\"\n"} 3
+test_requests_total{path="/",method="GET"} 0
+# HELP test_unknown Not a number.
+# TYPE test_unknown gauge
+test_unknown NaN
+`,
+		},
+		{
+			name:        "openmetrics",
+			openMetrics: true,
+			expected: `# HELP test_temperature Help with a \\ backslash, \"quotes\" and a\nnewline.
+# TYPE test_temperature gauge
+test_temperature 57.5
+# HELP test_requests Requests by path.
+# TYPE test_requests counter
+test_requests_total{path="C:\\mug \"one\"\n"} 3
+test_requests_total{path="/",method="GET"} 0
+# HELP test_unknown Not a number.
+# TYPE test_unknown gauge
+test_unknown NaN
+# EOF
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := writeMetrics(&buffer, families, test.openMetrics); err != nil {
+				t.Fatalf("writeMetrics: %v", err)
+			} else if buffer.String() != test.expected {
+				t.Errorf("output:\n%v\nexpected:\n%v", buffer.String(), test.expected)
+			}
+		})
+	}
+}
+
+var (
+	metricsCommentPattern = regexp.MustCompile(`^# (HELP|TYPE) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.*)$`)
+	metricsSamplePattern  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{((?:[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*",?)*)\})? (\S+)$`)
+)
+
+// validateMetrics checks the output against the rules of the exposition
+// format: every family has HELP and TYPE metadata before its samples, each
+// family appears once, and the samples belong to the family they follow.
+func validateMetrics(t *testing.T, output string, openMetrics bool) {
+	t.Helper()
+
+	if !strings.HasSuffix(output, "\n") {
+		t.Fatal("output does not end with a newline")
+	}
+
+	var (
+		lines    = strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+		families = make(map[string]bool)
+		family   string
+		kind     string
+		helped   bool
+	)
+
+	if openMetrics {
+		if lines[len(lines)-1] != "# EOF" {
+			t.Fatalf("last line = %q, expected # EOF", lines[len(lines)-1])
+		}
+		lines = lines[:len(lines)-1]
+	}
+
+	for number, line := range lines {
+		if match := metricsCommentPattern.FindStringSubmatch(line); match != nil {
+			switch match[1] {
+			case "HELP":
+				if families[match[2]] {
+					t.Errorf("line %v: family %v repeated", number+1, match[2])
+				}
+				families[match[2]] = true
+				family, kind, helped = match[2], "", true
+			case "TYPE":
+				if !helped || match[2] != family {
+					t.Errorf("line %v: TYPE for %v does not follow its HELP", number+1, match[2])
+				}
+				kind, helped = match[3], false
+				if kind != "gauge" && kind != "counter" {
+					t.Errorf("line %v: unknown type %q", number+1, kind)
+				}
+			}
+			continue
+		} else if strings.HasPrefix(line, "#") {
+			t.Errorf("line %v: unexpected comment %q", number+1, line)
+			continue
+		}
+
+		match := metricsSamplePattern.FindStringSubmatch(line)
+		if match == nil {
+			t.Errorf("line %v: malformed sample %q", number+1, line)
+			continue
+		} else if kind == "" {
+			t.Errorf("line %v: sample before TYPE", number+1)
+		}
+
+		// OpenMetrics names counter families without the suffix
+		var expected = family
+		if kind == "counter" && openMetrics {
+			expected = family + "_total"
+		} else if kind == "counter" && !strings.HasSuffix(family, "_total") {
+			t.Errorf("line %v: counter family %v without the _total suffix", number+1, family)
+		}
+		if match[1] != expected {
+			t.Errorf("line %v: sample %v in family %v", number+1, match[1], family)
+		}
+
+		if _, err := strconv.ParseFloat(match[3], 64); err != nil {
+			t.Errorf("line %v: value %q: %v", number+1, match[3], err)
+		}
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	states := map[string]service.State{
+		"disconnected": {},
+		"connected": {
+			Connected: true,
+			State:     embermug.StateHeating,
+			HasLiquid: true,
+			Current:   embermug.Celsius(45),
+			Target:    embermug.Celsius(57),
+			Battery:   embermug.BatteryState{Charge: 80, Charging: true, Temperature: embermug.Celsius(30)},
+		},
+	}
+
+	counters := service.Metrics{
+		Events:          map[embermug.Event]uint64{embermug.EventRefreshState: 4},
+		ConnectAttempts: 2,
+		ConnectFailures: 1,
+		Clients:         1,
+		ClientsTotal:    3,
+		Commands:        map[service.CommandOutcome]uint64{{Command: service.CommandSetTarget, Success: true}: 5},
+	}
+
+	for name, state := range states {
+		for _, openMetrics := range []bool{false, true} {
+			t.Run(name+"/"+strconv.FormatBool(openMetrics), func(t *testing.T) {
+				var buffer bytes.Buffer
+				if err := writeMetrics(&buffer, collectMetrics(state, counters), openMetrics); err != nil {
+					t.Fatalf("writeMetrics: %v", err)
+				}
+
+				validateMetrics(t, buffer.String(), openMetrics)
+
+				for _, sample := range []string{
+					"embermug_connected " + strconv.Itoa(int(boolValue(state.Connected))),
+					`embermug_events_total{event="` + embermug.EventRefreshState.String() + `"} 4`,
+					`embermug_commands_total{command="` + service.CommandSetTarget + `",result="success"} 5`,
+					"embermug_connect_failures_total 1",
+				} {
+					if !strings.Contains(buffer.String(), "\n"+sample+"\n") {
+						t.Errorf("missing sample %q", sample)
+					}
+				}
+
+				if state.Connected && !strings.Contains(buffer.String(), `embermug_state{state="`+embermug.StateHeating.String()+`"} 1`) {
+					t.Error("missing the liquid state")
+				} else if !state.Connected && strings.Contains(buffer.String(), "embermug_current_temperature_celsius") {
+					t.Error("temperature reported while disconnected")
+				}
+			})
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	handler := metricsHandler(service.New(nil, bluetooth.Address{}))
+
+	tests := []struct {
+		accept      string
+		contentType string
+		openMetrics bool
+	}{
+		{accept: "", contentType: metricsContentType},
+		{accept: "text/plain;version=0.0.4;q=0.5,*/*;q=0.1", contentType: metricsContentType},
+		{
+			accept:      "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5",
+			contentType: openMetricsContentType,
+			openMetrics: true,
+		},
+	}
+
+	for _, test := range tests {
+		var (
+			request  = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			recorder = httptest.NewRecorder()
+		)
+		if test.accept != "" {
+			request.Header.Set("Accept", test.accept)
+		}
+
+		handler.ServeHTTP(recorder, request)
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, expected %q", test.accept, contentType, test.contentType)
+		}
+		validateMetrics(t, recorder.Body.String(), test.openMetrics)
+	}
+}
@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttQoS               = 1
+	mqttDisconnectTimeout = 250 // milliseconds
+
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+)
+
+// mqttDeviceID converts the device address into an identifier which is safe
+// to use in MQTT topics and Home Assistant unique IDs.
+func mqttDeviceID(address string) string {
+	return "embermug_" + strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(address))
+}
+
+// mqttBridge publishes the mug state to an MQTT broker, and executes the
+// commands received on the command topics.
+type mqttBridge struct {
+	config   MQTTConfig
+	svc      *service.Service
+	client   mqtt.Client
+	logger   *slog.Logger
+	deviceID string
+	base     string
+	presets  []string
+
+	lock      sync.Mutex
+	state     service.State     // Most recent state
+	published map[string]string // Payloads published to each state topic since the last connect
+}
+
+// newMQTTBridge creates the bridge and its MQTT client. The client is not
+// connected until [mqttClient] is started.
+func newMQTTBridge(svc *service.Service, cfg MQTTConfig, deviceID string, presets []service.Preset) *mqttBridge {
+	var bridge = &mqttBridge{
+		config:    cfg,
+		svc:       svc,
+		logger:    slog.With("Broker", cfg.Broker),
+		deviceID:  deviceID,
+		base:      cfg.TopicPrefix + "/" + deviceID,
+		published: make(map[string]string),
+	}
+
+	for _, preset := range presets {
+		bridge.presets = append(bridge.presets, preset.Name)
+	}
+
+	if bridge.config.ClientID == "" {
+		bridge.config.ClientID = deviceID
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(bridge.config.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetOrderMatters(false).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10*time.Second).
+		SetWill(bridge.topic("availability"), mqttOffline, mqttQoS, true).
+		SetOnConnectHandler(bridge.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			bridge.logger.Warn("Lost connection to MQTT broker", "Error", err)
+		})
+
+	bridge.client = mqtt.NewClient(options)
+
+	return bridge
+}
+
+// topic returns the full topic name for the given topic relative to the device
+func (b *mqttBridge) topic(name string) string {
+	return mqttTopic(b.base, name)
+}
+
+// mqttTopic returns the full topic name for the given topic relative to the
+// device base topic.
+func mqttTopic(base, name string) string {
+	return base + "/" + name
+}
+
+// mqttCommands maps each command topic (relative to the device) to the
+// function which converts its payload into a service message.
+var mqttCommands = map[string]func(payload string) (service.Message, error){
+	"target/set": func(payload string) (msg service.Message, err error) {
+		celsius, err := strconv.ParseFloat(payload, 64)
+		msg.SetTarget = embermug.Celsius(celsius)
+		return msg, err
+	},
+	"color/set": func(payload string) (msg service.Message, err error) {
+		color, err := parseColor(payload)
+		msg.SetColor = &color
+		return msg, err
+	},
+	"preset/set": func(payload string) (msg service.Message, err error) {
+		msg.ApplyPreset = payload
+		return msg, nil
+	},
+	"reconnect": func(payload string) (msg service.Message, err error) {
+		msg.Reconnect = true
+		return msg, nil
+	},
+}
+
+// onConnect subscribes to the command topics, and publishes the discovery
+// payloads and the complete state. It is invoked on every (re)connect.
+func (b *mqttBridge) onConnect(client mqtt.Client) {
+	b.logger.Info("Connected to MQTT broker")
+
+	for name, parse := range mqttCommands {
+		var topic = b.topic(name)
+		if token := client.Subscribe(topic, mqttQoS, b.commandHandler(parse)); token.Wait() && token.Error() != nil {
+			b.logger.Error("Could not subscribe to command topic", "Topic", topic, "Error", token.Error())
+		}
+	}
+
+	if b.config.Discovery {
+		b.publishDiscovery()
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	clear(b.published)
+	b.publishStateLocked()
+}
+
+// commandHandler returns a message handler which converts the payload into a
+// service message with the given parse function, and executes it.
+func (b *mqttBridge) commandHandler(parse func(payload string) (service.Message, error)) mqtt.MessageHandler {
+	return func(_ mqtt.Client, message mqtt.Message) {
+		var (
+			payload = strings.TrimSpace(string(message.Payload()))
+			logger  = b.logger.With("Topic", message.Topic(), "Payload", payload)
+		)
+
+		if msg, err := parse(payload); err != nil {
+			logger.Error("Invalid MQTT command", "Error", err)
+		} else if err := b.svc.HandleMessage(msg); err != nil {
+			logger.Error("MQTT command failed", "Error", err)
+		} else {
+			logger.Debug("Executed MQTT command")
+		}
+	}
+}
+
+// update records the given state, and publishes it if connected
+func (b *mqttBridge) update(state service.State) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = state
+	if b.client.IsConnectionOpen() {
+		b.publishStateLocked()
+	}
+}
+
+// publishStateLocked publishes each state topic whose value changed since it
+// was last published. You must hold the bridge lock.
+func (b *mqttBridge) publishStateLocked() {
+	values, err := mqttStateValues(b.state)
+	if err != nil {
+		b.logger.Error("Could not encode state", "Error", err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if previous, ok := b.published[name]; ok && previous == values[name] {
+			continue
+		}
+
+		b.client.Publish(b.topic(name), mqttQoS, true, values[name])
+		b.published[name] = values[name]
+	}
+}
+
+// mqttStateValues returns the payload of each state topic (relative to the
+// device) for the given state. The 'availability' topic follows the mug
+// connection, and matches the payload of the last will while disconnected.
+// If the state cannot be encoded, the 'state' topic is omitted.
+func mqttStateValues(state service.State) (map[string]string, error) {
+	var values = map[string]string{
+		"availability": mqttOffline,
+		"current":      strconv.FormatFloat(state.Current.Celsius(), 'f', 2, 64),
+		"target":       strconv.FormatFloat(state.Target.Celsius(), 'f', 2, 64),
+		"battery":      strconv.Itoa(state.Battery.Charge),
+		"charging":     mqttSwitch(state.Battery.Charging),
+		"has_liquid":   mqttSwitch(state.HasLiquid),
+		"liquid_state": state.State.String(),
+		"preset":       state.Preset,
+		"action":       "idle",
+	}
+
+	if state.Connected {
+		values["availability"] = mqttOnline
+	}
+
+	switch state.State {
+	case embermug.StateHeating:
+		values["action"] = "heating"
+	case embermug.StateEmpty:
+		values["action"] = "off"
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return values, err
+	}
+	values["state"] = string(data)
+
+	return values, nil
+}
+
+// mqttEntity is a Home Assistant entity announced through MQTT discovery
+type mqttEntity struct {
+	component string         // Home Assistant component (e.g. 'sensor')
+	object    string         // Entity identifier, unique within the device
+	config    map[string]any // Component specific discovery configuration
+}
+
+// publishDiscovery publishes the Home Assistant MQTT discovery payloads for
+// the mug entities.
+func (b *mqttBridge) publishDiscovery() {
+	payloads, err := mqttDiscoveryPayloads(b.config.DiscoveryPrefix, b.base, b.deviceID, b.presets)
+	if err != nil {
+		b.logger.Error("Could not encode discovery payloads", "Error", err)
+		return
+	}
+
+	for _, topic := range slices.Sorted(maps.Keys(payloads)) {
+		b.client.Publish(topic, mqttQoS, true, payloads[topic])
+	}
+}
+
+// mqttDiscoveryPayloads returns the Home Assistant MQTT discovery payload of
+// each mug entity, keyed by the discovery topic. The preset select is only
+// announced if presets are defined.
+func mqttDiscoveryPayloads(prefix, base, deviceID string, presets []string) (map[string][]byte, error) {
+	var (
+		topic = func(name string) string {
+			return mqttTopic(base, name)
+		}
+		payloads = make(map[string][]byte)
+		device   = map[string]any{
+			"identifiers":  []string{deviceID},
+			"name":         "Ember Mug",
+			"manufacturer": "Ember",
+		}
+		entities = []mqttEntity{
+			{"climate", "mug", map[string]any{
+				"name":                      nil,
+				"modes":                     []string{"heat"},
+				"current_temperature_topic": topic("current"),
+				"temperature_state_topic":   topic("target"),
+				"temperature_command_topic": topic("target/set"),
+				"action_topic":              topic("action"),
+				"min_temp":                  service.MinTarget.Celsius(),
+				"max_temp":                  service.MaxTarget.Celsius(),
+				"temp_step":                 0.5,
+				"precision":                 0.1,
+				"temperature_unit":          "C",
+			}},
+			{"sensor", "temperature", map[string]any{
+				"name":                "Temperature",
+				"device_class":        "temperature",
+				"state_class":         "measurement",
+				"unit_of_measurement": "°C",
+				"state_topic":         topic("current"),
+			}},
+			{"sensor", "battery", map[string]any{
+				"name":                "Battery",
+				"device_class":        "battery",
+				"state_class":         "measurement",
+				"unit_of_measurement": "%",
+				"state_topic":         topic("battery"),
+			}},
+			{"sensor", "liquid_state", map[string]any{
+				"name":         "Liquid State",
+				"device_class": "enum",
+				"options":      []string{"empty", "filling", "unknown", "cooling", "heating", "stable", "invalid"},
+				"state_topic":  topic("liquid_state"),
+			}},
+			{"binary_sensor", "charging", map[string]any{
+				"name":         "Charging",
+				"device_class": "battery_charging",
+				"state_topic":  topic("charging"),
+			}},
+			{"binary_sensor", "has_liquid", map[string]any{
+				"name":        "Liquid",
+				"state_topic": topic("has_liquid"),
+			}},
+			{"button", "reconnect", map[string]any{
+				"name":          "Reconnect",
+				"command_topic": topic("reconnect"),
+				// The reconnect button must work while the mug is disconnected
+				"availability_topic": nil,
+			}},
+		}
+	)
+
+	if len(presets) > 0 {
+		entities = append(entities, mqttEntity{"select", "preset", map[string]any{
+			"name":          "Preset",
+			"options":       presets,
+			"state_topic":   topic("preset"),
+			"command_topic": topic("preset/set"),
+		}})
+	}
+
+	for _, entity := range entities {
+		var config = map[string]any{
+			"unique_id":          deviceID + "_" + entity.object,
+			"object_id":          deviceID + "_" + entity.object,
+			"device":             device,
+			"availability_topic": topic("availability"),
+		}
+		// A nil value removes a default key, except for the name where null
+		// tells Home Assistant to use the device name.
+		for key, value := range entity.config {
+			if value == nil && key != "name" {
+				delete(config, key)
+			} else {
+				config[key] = value
+			}
+		}
+
+		var topic = fmt.Sprintf("%v/%v/%v/%v/config", prefix, entity.component, deviceID, entity.object)
+		if data, err := json.Marshal(config); err != nil {
+			return nil, fmt.Errorf("%v: %w", topic, err)
+		} else {
+			payloads[topic] = data
+		}
+	}
+
+	return payloads, nil
+}
+
+// mqttSwitch formats a boolean in the default Home Assistant binary sensor format
+func mqttSwitch(value bool) string {
+	if value {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// mqttClient publishes every state update to the MQTT broker until the client
+// context is cancelled. The mug is marked unavailable before disconnecting.
+func mqttClient(client *service.Client, bridge *mqttBridge) {
+	var logger = bridge.logger.With("ClientID", client.ID)
+
+	logger.Info("MQTT Client Started", "Topic", bridge.base)
+
+	// With connect retry enabled, the token completes once the broker is
+	// reachable. Connection errors are logged by the connection lost handler.
+	bridge.client.Connect()
+
+	defer func() {
+		if bridge.client.IsConnectionOpen() {
+			bridge.client.Publish(bridge.topic("availability"), mqttQoS, true, mqttOffline).Wait()
+		}
+		bridge.client.Disconnect(mqttDisconnectTimeout)
+	}()
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			bridge.update(state)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+func TestMQTTDeviceID(t *testing.T) {
+	tests := map[string]string{
+		"AA:BB:CC:DD:EE:FF":                    "embermug_aabbccddeeff",
+		"aa-bb-cc-dd-ee-ff":                    "embermug_aabbccddeeff",
+		"12345678-ABCD-1234-ABCD-1234567890AB": "embermug_12345678abcd1234abcd1234567890ab",
+	}
+
+	for address, expected := range tests {
+		if id := mqttDeviceID(address); id != expected {
+			t.Errorf("mqttDeviceID(%q) = %q, expected %q", address, id, expected)
+		}
+	}
+}
+
+func TestMQTTLastWill(t *testing.T) {
+	bridge := newMQTTBridge(nil, MQTTConfig{
+		Broker:      "tcp://localhost:1883",
+		TopicPrefix: "embermug",
+	}, "embermug_aabbccddeeff", nil)
+
+	options := bridge.client.OptionsReader()
+	if !options.WillEnabled() {
+		t.Fatal("last will is not enabled")
+	}
+	if topic := options.WillTopic(); topic != "embermug/embermug_aabbccddeeff/availability" {
+		t.Errorf("will topic = %q", topic)
+	}
+	if payload := string(options.WillPayload()); payload != mqttOffline {
+		t.Errorf("will payload = %q, expected %q", payload, mqttOffline)
+	}
+	if !options.WillRetained() {
+		t.Error("will is not retained")
+	}
+	if id := options.ClientID(); id != "embermug_aabbccddeeff" {
+		t.Errorf("client ID = %q, expected the device ID", id)
+	}
+}
+
+func TestMQTTStateValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    service.State
+		expected map[string]string
+	}{
+		{
+			name:  "disconnected",
+			state: service.State{},
+			expected: map[string]string{
+				"availability": mqttOffline,
+				"action":       "idle",
+				"charging":     "OFF",
+				"has_liquid":   "OFF",
+			},
+		},
+		{
+			name: "heating",
+			state: service.State{
+				Connected: true,
+				State:     embermug.StateHeating,
+				HasLiquid: true,
+				Current:   embermug.Celsius(45.5),
+				Target:    embermug.Celsius(57),
+				Battery:   embermug.BatteryState{Charge: 80, Charging: true},
+				Preset:    "coffee",
+			},
+			expected: map[string]string{
+				"availability": mqttOnline,
+				"action":       "heating",
+				"current":      "45.50",
+				"target":       "57.00",
+				"battery":      "80",
+				"charging":     "ON",
+				"has_liquid":   "ON",
+				"liquid_state": embermug.StateHeating.String(),
+				"preset":       "coffee",
+			},
+		},
+		{
+			name:  "empty",
+			state: service.State{Connected: true, State: embermug.StateEmpty},
+			expected: map[string]string{
+				"availability": mqttOnline,
+				"action":       "off",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := mqttStateValues(test.state)
+			if err != nil {
+				t.Fatalf("mqttStateValues: %v", err)
+			}
+
+			for name, expected := range test.expected {
+				if values[name] != expected {
+					t.Errorf("%v = %q, expected %q", name, values[name], expected)
+				}
+			}
+
+			var state service.State
+			if err := json.Unmarshal([]byte(values["state"]), &state); err != nil {
+				t.Fatalf("state topic is not a JSON state: %v", err)
+			} else if state.Connected != test.state.Connected || state.Target != test.state.Target {
+				t.Errorf("state = %+v, expected %+v", state, test.state)
+			}
+		})
+	}
+}
+
+func TestMQTTDiscoveryPayloads(t *testing.T) {
+	const (
+		prefix   = "homeassistant"
+		base     = "embermug/embermug_aabbccddeeff"
+		deviceID = "embermug_aabbccddeeff"
+	)
+
+	decode := func(t *testing.T, payloads map[string][]byte, topic string) map[string]any {
+		t.Helper()
+
+		data, ok := payloads[topic]
+		if !ok {
+			t.Fatalf("missing discovery topic %q in %v", topic, slices.Sorted(maps.Keys(payloads)))
+		}
+
+		var config map[string]any
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatalf("%v: %v", topic, err)
+		}
+		return config
+	}
+
+	t.Run("entities", func(t *testing.T) {
+		payloads, err := mqttDiscoveryPayloads(prefix, base, deviceID, nil)
+		if err != nil {
+			t.Fatalf("mqttDiscoveryPayloads: %v", err)
+		}
+
+		expected := []string{
+			"homeassistant/binary_sensor/embermug_aabbccddeeff/charging/config",
+			"homeassistant/binary_sensor/embermug_aabbccddeeff/has_liquid/config",
+			"homeassistant/button/embermug_aabbccddeeff/reconnect/config",
+			"homeassistant/climate/embermug_aabbccddeeff/mug/config",
+			"homeassistant/sensor/embermug_aabbccddeeff/battery/config",
+			"homeassistant/sensor/embermug_aabbccddeeff/liquid_state/config",
+			"homeassistant/sensor/embermug_aabbccddeeff/temperature/config",
+		}
+		if topics := slices.Sorted(maps.Keys(payloads)); !slices.Equal(topics, expected) {
+			t.Fatalf("topics = %v, expected %v", topics, expected)
+		}
+
+		for topic := range payloads {
+			config := decode(t, payloads, topic)
+			if device, ok := config["device"].(map[string]any); !ok || !slices.Contains(device["identifiers"].([]any), any(deviceID)) {
+				t.Errorf("%v: device = %v", topic, config["device"])
+			}
+		}
+
+		climate := decode(t, payloads, "homeassistant/climate/embermug_aabbccddeeff/mug/config")
+		if name, ok := climate["name"]; !ok || name != nil {
+			t.Errorf("climate name = %v, expected null", name)
+		}
+		if climate["unique_id"] != deviceID+"_mug" {
+			t.Errorf("climate unique_id = %v", climate["unique_id"])
+		}
+		if climate["availability_topic"] != base+"/availability" {
+			t.Errorf("climate availability_topic = %v", climate["availability_topic"])
+		}
+		if climate["temperature_command_topic"] != base+"/target/set" {
+			t.Errorf("climate temperature_command_topic = %v", climate["temperature_command_topic"])
+		}
+		if climate["min_temp"] != service.MinTarget.Celsius() || climate["max_temp"] != service.MaxTarget.Celsius() {
+			t.Errorf("climate range = %v-%v", climate["min_temp"], climate["max_temp"])
+		}
+
+		reconnect := decode(t, payloads, "homeassistant/button/embermug_aabbccddeeff/reconnect/config")
+		if topic, ok := reconnect["availability_topic"]; ok {
+			t.Errorf("reconnect availability_topic = %v, expected none", topic)
+		}
+	})
+
+	t.Run("presets", func(t *testing.T) {
+		payloads, err := mqttDiscoveryPayloads(prefix, base, deviceID, []string{"coffee", "tea"})
+		if err != nil {
+			t.Fatalf("mqttDiscoveryPayloads: %v", err)
+		}
+
+		preset := decode(t, payloads, "homeassistant/select/embermug_aabbccddeeff/preset/config")
+		if options, _ := json.Marshal(preset["options"]); string(options) != `["coffee","tea"]` {
+			t.Errorf("preset options = %s", options)
+		}
+		if preset["command_topic"] != base+"/preset/set" || preset["state_topic"] != base+"/preset" {
+			t.Errorf("preset topics = %v, %v", preset["command_topic"], preset["state_topic"])
+		}
+	})
+
+	t.Run("command topics", func(t *testing.T) {
+		payloads, err := mqttDiscoveryPayloads(prefix, base, deviceID, []string{"coffee"})
+		if err != nil {
+			t.Fatalf("mqttDiscoveryPayloads: %v", err)
+		}
+
+		// Every command topic announced to Home Assistant must be subscribed
+		for topic := range payloads {
+			config := decode(t, payloads, topic)
+			for _, key := range []string{"command_topic", "temperature_command_topic"} {
+				if command, ok := config[key].(string); ok {
+					if _, ok := mqttCommands[command[len(base)+1:]]; !ok {
+						t.Errorf("%v: %v %q has no command handler", topic, key, command)
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestMQTTCommands(t *testing.T) {
+	red := embermug.Color{Red: 0xff, Alpha: 0xff}
+
+	tests := []struct {
+		topic    string
+		payload  string
+		expected service.Message
+		invalid  bool
+	}{
+		{topic: "target/set", payload: "57.5", expected: service.Message{SetTarget: embermug.Celsius(57.5)}},
+		{topic: "target/set", payload: "hot", invalid: true},
+		{topic: "color/set", payload: "#ff0000", expected: service.Message{SetColor: &red}},
+		{topic: "color/set", payload: "red", invalid: true},
+		{topic: "preset/set", payload: "Coffee", expected: service.Message{ApplyPreset: "Coffee"}},
+		{topic: "reconnect", payload: "", expected: service.Message{Reconnect: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.topic+" "+test.payload, func(t *testing.T) {
+			parse, ok := mqttCommands[test.topic]
+			if !ok {
+				t.Fatalf("no command handler for %q", test.topic)
+			}
+
+			msg, err := parse(test.payload)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("expected an error for %q", test.payload)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			if msg.SetTarget != test.expected.SetTarget || msg.ApplyPreset != test.expected.ApplyPreset || msg.Reconnect != test.expected.Reconnect {
+				t.Errorf("message = %+v, expected %+v", msg, test.expected)
+			}
+			if (msg.SetColor == nil) != (test.expected.SetColor == nil) || (msg.SetColor != nil && *msg.SetColor != *test.expected.SetColor) {
+				t.Errorf("color = %v, expected %v", msg.SetColor, test.expected.SetColor)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+// notificationCheckInterval is how often debounced rules are re-evaluated
+// when no state updates arrive (e.g. while the mug is disconnected).
+const notificationCheckInterval = 5 * time.Second
+
+var (
+	ErrInvalidNotificationTrigger = errors.New("invalid notification trigger")
+	ErrInvalidNotificationUrgency = errors.New("invalid notification urgency: expected 'low', 'normal' or 'critical'")
+	ErrInvalidNotificationAction  = errors.New("notification action must define a label and exactly one command")
+)
+
+var notificationUrgencies = map[string]notify.Urgency{
+	"":         notify.UrgencyNormal,
+	"low":      notify.UrgencyLow,
+	"normal":   notify.UrgencyNormal,
+	"critical": notify.UrgencyCritical,
+}
+
+// defaultNotificationText holds the summary and body used when a rule does
+// not define its own.
+var defaultNotificationText = map[NotificationTrigger][2]string{
+	TriggerTargetReached: {
+		"Ember Mug Optimal Temperature Reached!",
+		"Your Ember Mug has reached its target optimal temperature of {{ toFahrenheit .Target }}F!",
+	},
+	TriggerBatteryLow: {
+		"Ember Mug Battery Low",
+		"Your Ember Mug battery is at {{ .Battery.Charge }}%.",
+	},
+	TriggerChargingComplete: {
+		"Ember Mug Charged",
+		"Your Ember Mug battery is fully charged.",
+	},
+	TriggerEmptied: {
+		"Ember Mug Empty",
+		"Your Ember Mug is empty. Time for a refill?",
+	},
+	TriggerDisconnected: {
+		"Ember Mug Disconnected",
+		"Your Ember Mug is no longer connected.",
+	},
+	TriggerTemperatureBelow: {
+		"Ember Mug Getting Cold",
+		"Your drink has cooled to {{ toFahrenheit .Current }}F.",
+	},
+}
+
+// defaultNotifications is used when notifications are enabled, but no rules
+// are configured.
+var defaultNotifications = []NotificationConfig{
+	{
+		Trigger: TriggerTargetReached,
+		Timeout: 5 * time.Second,
+	},
+}
+
+// notificationCondition reports whether the condition of a rule is active for
+// the given state. If known is false, the state does not provide enough
+// information, and the previous result is kept.
+type notificationCondition func(state service.State) (active bool, known bool)
+
+// notificationRule is a compiled [NotificationConfig] along with the state
+// required to detect when the rule should fire.
+type notificationRule struct {
+	config    NotificationConfig
+	condition notificationCondition
+	summary   *template.Template
+	body      *template.Template
+	urgency   notify.Urgency
+	actions   []notificationAction
+
+	initialized bool      // Whether the condition has been observed at least once
+	active      bool      // Whether the condition is currently active
+	activeSince time.Time // Time the condition became active
+	fired       bool      // Whether the rule fired (or was suppressed) since becoming active
+	lastFired   time.Time // Time the rule last sent a notification
+}
+
+// notificationAction is a compiled [NotificationActionConfig]
+type notificationAction struct {
+	label   string
+	message service.Message
+}
+
+// newNotificationAction converts the action configuration into the service
+// message which is executed when the action is invoked.
+func newNotificationAction(cfg NotificationActionConfig) (notificationAction, error) {
+	var (
+		action   = notificationAction{label: cfg.Label}
+		commands = 0
+	)
+
+	if cfg.Preset != "" {
+		action.message.ApplyPreset = cfg.Preset
+		commands += 1
+	}
+
+	if cfg.Fahrenheit != 0 || cfg.Celsius != 0 {
+		if preset, err := (PresetConfig{Fahrenheit: cfg.Fahrenheit, Celsius: cfg.Celsius}).Preset(""); err != nil {
+			return action, err
+		} else {
+			action.message.SetTarget = preset.Target
+		}
+		commands += 1
+	}
+
+	if cfg.AdjustFahrenheit != 0 {
+		// Differences in fahrenheit scale without the 32 degree offset
+		action.message.AdjustTarget = embermug.Temperature(cfg.AdjustFahrenheit * 500 / 9)
+		commands += 1
+	}
+
+	if cfg.AdjustCelsius != 0 {
+		action.message.AdjustTarget = embermug.Celsius(cfg.AdjustCelsius)
+		commands += 1
+	}
+
+	if cfg.Reconnect {
+		action.message.Reconnect = true
+		commands += 1
+	}
+
+	if cfg.Label == "" || commands != 1 {
+		return action, fmt.Errorf("%w: %q", ErrInvalidNotificationAction, cfg.Label)
+	}
+
+	return action, nil
+}
+
+// newNotificationRule compiles the given rule configuration
+func newNotificationRule(cfg NotificationConfig) (*notificationRule, error) {
+	var (
+		rule  = &notificationRule{config: cfg}
+		funcs = templateFuncs()
+		text  = defaultNotificationText[cfg.Trigger]
+	)
+
+	switch cfg.Trigger {
+	case TriggerTargetReached:
+		rule.condition = func(state service.State) (bool, bool) {
+			return state.State == embermug.StateStable, state.Connected
+		}
+	case TriggerBatteryLow:
+		if cfg.Battery <= 0 || cfg.Battery > 100 {
+			return nil, fmt.Errorf("%v: 'battery' must be between 1 and 100", cfg.Trigger)
+		}
+		rule.condition = func(state service.State) (bool, bool) {
+			return !state.Battery.Charging && state.Battery.Charge <= cfg.Battery, state.Connected
+		}
+	case TriggerChargingComplete:
+		rule.condition = func(state service.State) (bool, bool) {
+			return state.Battery.Charging && state.Battery.Charge >= 100, state.Connected
+		}
+	case TriggerEmptied:
+		rule.condition = func(state service.State) (bool, bool) {
+			return state.State == embermug.StateEmpty, state.Connected && state.State != embermug.StateInvalid
+		}
+	case TriggerDisconnected:
+		rule.condition = func(state service.State) (bool, bool) {
+			return !state.Connected, true
+		}
+	case TriggerTemperatureBelow:
+		var threshold embermug.Temperature
+		if preset, err := (PresetConfig{Fahrenheit: cfg.Fahrenheit, Celsius: cfg.Celsius}).Preset(""); err != nil {
+			return nil, fmt.Errorf("%v: %w", cfg.Trigger, err)
+		} else {
+			threshold = preset.Target
+		}
+		rule.condition = func(state service.State) (bool, bool) {
+			return state.Current < threshold, state.Connected && state.HasLiquid
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidNotificationTrigger, cfg.Trigger)
+	}
+
+	if urgency, ok := notificationUrgencies[strings.ToLower(cfg.Urgency)]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidNotificationUrgency, cfg.Urgency)
+	} else {
+		rule.urgency = urgency
+	}
+
+	for index, actionConfig := range cfg.Actions {
+		if action, err := newNotificationAction(actionConfig); err != nil {
+			return nil, fmt.Errorf("action %v: %w", index, err)
+		} else {
+			rule.actions = append(rule.actions, action)
+		}
+	}
+
+	if cfg.Summary != "" {
+		text[0] = cfg.Summary
+	}
+	if cfg.Body != "" {
+		text[1] = cfg.Body
+	}
+
+	if summary, err := template.New("summary").Funcs(funcs).Parse(text[0]); err != nil {
+		return nil, fmt.Errorf("summary: %w", err)
+	} else {
+		rule.summary = summary
+	}
+
+	if body, err := template.New("body").Funcs(funcs).Parse(text[1]); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	} else {
+		rule.body = body
+	}
+
+	return rule, nil
+}
+
+// compileNotificationRules compiles the configured notification rules. If no
+// rules are configured, the default rules are returned.
+func compileNotificationRules(configs []NotificationConfig) ([]*notificationRule, error) {
+	var rules []*notificationRule
+
+	if len(configs) == 0 {
+		configs = defaultNotifications
+	}
+
+	for index, cfg := range configs {
+		if rule, err := newNotificationRule(cfg); err != nil {
+			return nil, fmt.Errorf("notification rule %v: %w", index, err)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// observe updates the condition of the rule from the given state. The first
+// observation only records the condition, so a notification is not sent
+// for a condition which was already active when the notifier started.
+func (r *notificationRule) observe(now time.Time, state service.State) {
+	active, known := r.condition(state)
+	if !known {
+		return
+	}
+
+	if !r.initialized {
+		r.initialized = true
+		r.active = active
+		r.activeSince = now
+		r.fired = active
+	} else if active && !r.active {
+		r.active = true
+		r.activeSince = now
+		r.fired = false
+	} else if !active {
+		r.active = false
+		r.fired = false
+	}
+}
+
+// due returns true if the rule should send a notification now. A rule is due
+// once its condition has been active for the debounce period. If the rule is
+// still cooling down from a previous notification, this activation is skipped.
+func (r *notificationRule) due(now time.Time) bool {
+	if !r.active || r.fired || now.Sub(r.activeSince) < r.config.Debounce {
+		return false
+	}
+
+	r.fired = true
+
+	if !r.lastFired.IsZero() && now.Sub(r.lastFired) < r.config.Cooldown {
+		slog.Debug("Suppressing notification during cooldown", "Trigger", r.config.Trigger)
+		return false
+	}
+
+	r.lastFired = now
+	return true
+}
+
+// render creates the notification for the given state
+func (r *notificationRule) render(state service.State) (notify.Notification, error) {
+	var (
+		summary      strings.Builder
+		body         strings.Builder
+		notification = notify.Notification{
+			AppName:       "Ember Mug",
+			AppIcon:       r.config.Icon,
+			ExpireTimeout: r.config.Timeout,
+		}
+	)
+
+	if r.config.Timeout == 0 {
+		notification.ExpireTimeout = notify.ExpireTimeoutSetByNotificationServer
+	}
+
+	if err := r.summary.Execute(&summary, state); err != nil {
+		return notification, fmt.Errorf("summary: %w", err)
+	} else if err := r.body.Execute(&body, state); err != nil {
+		return notification, fmt.Errorf("body: %w", err)
+	}
+
+	notification.Summary = summary.String()
+	notification.Body = body.String()
+	notification.SetUrgency(r.urgency)
+
+	// Action keys are the index of the action within the rule
+	for index, action := range r.actions {
+		notification.Actions = append(notification.Actions, notify.Action{
+			Key:   strconv.Itoa(index),
+			Label: action.label,
+		})
+	}
+
+	return notification, nil
+}
+
+// notificationTracker remembers which rule sent each notification that is
+// still on screen, so invoked actions can be mapped back to the rule. The
+// notification server reports actions and closures from the D-Bus signal
+// loop, so the tracker is safe for concurrent use.
+type notificationTracker struct {
+	lock  sync.Mutex
+	rules map[uint32]*notificationRule
+}
+
+// sent records a notification delivered for the given rule
+func (t *notificationTracker) sent(id uint32, rule *notificationRule) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.rules == nil {
+		t.rules = make(map[uint32]*notificationRule)
+	}
+	t.rules[id] = rule
+}
+
+// closed forgets a notification which is no longer shown
+func (t *notificationTracker) closed(signal *notify.NotificationClosedSignal) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.rules, signal.ID)
+}
+
+// action returns the action which was invoked by the given signal
+func (t *notificationTracker) action(signal *notify.ActionInvokedSignal) (notificationAction, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	rule, ok := t.rules[signal.ID]
+	if !ok {
+		return notificationAction{}, false
+	}
+
+	index, err := strconv.Atoi(signal.ActionKey)
+	if err != nil || index < 0 || index >= len(rule.actions) {
+		return notificationAction{}, false
+	}
+
+	return rule.actions[index], true
+}
+
+// notifierClient sends desktop notifications whenever one of the given rules
+// fires, and executes the notification actions invoked by the user.
+func notifierClient(svc *service.Service, client *service.Client, rules []*notificationRule) {
+	var (
+		lastState service.State
+		tracker   notificationTracker
+		logger    = slog.With("ClientID", client.ID)
+		ticker    = time.NewTicker(notificationCheckInterval)
+	)
+	defer ticker.Stop()
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		logger.Error("Could not open private bus. Notifications Disabled.", "Error", err)
+		return
+	}
+	defer conn.Close()
+
+	notifier, err := notify.New(
+		conn,
+		notify.WithOnClosed(tracker.closed),
+		notify.WithOnAction(func(signal *notify.ActionInvokedSignal) {
+			// Signals for notifications from other applications are ignored
+			action, ok := tracker.action(signal)
+			if !ok {
+				return
+			}
+
+			logger.Info("Notification action invoked", "Action", action.label)
+			if err := svc.HandleMessage(action.message); err != nil {
+				logger.Error("Notification action failed", "Action", action.label, "Error", err)
+			}
+		}),
+	)
+	if err != nil {
+		logger.Error("Could not subscribe to notification signals. Notifications Disabled.", "Error", err)
+		return
+	}
+	defer notifier.Close()
+
+	logger.Info("Notification Client Started", "Rules", len(rules))
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			lastState = state
+			for _, rule := range rules {
+				rule.observe(time.Now(), state)
+			}
+		case <-ticker.C:
+		}
+
+		for _, rule := range rules {
+			if !rule.due(time.Now()) {
+				continue
+			}
+
+			logger.Debug("Sending desktop notification", "Trigger", rule.config.Trigger)
+
+			if notification, err := rule.render(lastState); err != nil {
+				logger.Error("Could not render notification", "Trigger", rule.config.Trigger, "Error", err)
+			} else if id, err := notifier.SendNotification(notification); err != nil {
+				logger.Error("Could not deliver notification", "Error", err)
+			} else if len(rule.actions) > 0 {
+				tracker.sent(id, rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var presetCommand = cobra.Command{
+	Use:   "preset [name]",
+	Short: "Apply a named temperature preset",
+	Long: `Apply a named temperature preset
+
+Presets are defined in the [presets] table of the configuration file. Each
+preset defines a target temperature and an optional LED color. This command
+asks the running embermug service to apply the named preset to the mug. If
+no name is given, the configured presets are listed.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  commandExitWrapper(presetEntrypoint),
+}
+
+func init() {
+	rootCmd.AddCommand(&presetCommand)
+}
+
+func presetEntrypoint(cmd *cobra.Command, args []string) error {
+	var cfg Config
+
+	if err := viper.Unmarshal(&cfg); err != nil {
+		slog.Error("Invalid configuration", "Error", err)
+		return err
+	}
+
+	if len(args) == 0 {
+		return listPresets(&cfg)
+	}
+
+	if state, err := sendServiceMessage(&cfg, service.Message{
+		ApplyPreset: args[0],
+	}); err != nil {
+		slog.Error("Could not apply preset", "Preset", args[0], "Error", err)
+		return err
+	} else {
+		fmt.Printf("Applied preset %v (target %v)\n", args[0], formatTemperature(state.Target))
+	}
+
+	return nil
+}
+
+func listPresets(cfg *Config) error {
+	var writer = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	presets, err := cfg.ServicePresets()
+	if err != nil {
+		slog.Error("Invalid preset configuration", "Error", err)
+		return err
+	}
+
+	fmt.Fprintln(writer, "NAME\tTARGET\tCOLOR")
+	for _, preset := range presets {
+		var color = "-"
+		if preset.Color != nil {
+			color = fmt.Sprintf("#%02x%02x%02x%02x", preset.Color.Red, preset.Color.Green, preset.Color.Blue, preset.Color.Alpha)
+		}
+
+		fmt.Fprintf(writer, "%v\t%v\t%v\n", preset.Name, formatTemperature(preset.Target), color)
+	}
+	return nil
+}
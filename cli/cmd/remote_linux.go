@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// remoteAuthTimeout limits how long remote clients may take to complete
+	// the TLS handshake and send their token.
+	remoteAuthTimeout = 10 * time.Second
+
+	// remoteDialTimeout limits how long clients wait to connect to the service
+	remoteDialTimeout = 10 * time.Second
+)
+
+var (
+	ErrUnknownScheme       = errors.New("unknown address scheme: expected 'unix://', 'tcp://' or 'tls://'")
+	ErrNotUnixSocket       = errors.New("socket path must be a unix socket (use 'service.listeners' for remote clients)")
+	ErrInvalidCertificates = errors.New("no certificates found")
+	ErrInvalidToken        = errors.New("invalid token")
+)
+
+// Address schemes accepted by [parseSocketAddress]
+const (
+	schemeUnix = "unix"
+	schemeTCP  = "tcp"
+	schemeTLS  = "tls"
+)
+
+// remoteHello is the first message sent by clients of a listener with token
+// authentication.
+type remoteHello struct {
+	Token string
+}
+
+// parseSocketAddress splits an address such as 'tls://host:port' into its
+// scheme and address. Addresses without a scheme are unix socket paths.
+func parseSocketAddress(address string) (scheme string, addr string, err error) {
+	scheme, addr, ok := strings.Cut(address, "://")
+	if !ok {
+		return schemeUnix, address, nil
+	}
+
+	switch scheme {
+	case schemeUnix, schemeTCP, schemeTLS:
+		return scheme, addr, nil
+	default:
+		return "", "", fmt.Errorf("%w: %q", ErrUnknownScheme, address)
+	}
+}
+
+// unixSocketPath returns the path of a unix socket address
+func unixSocketPath(address string) (string, error) {
+	if scheme, path, err := parseSocketAddress(address); err != nil {
+		return "", err
+	} else if scheme != schemeUnix {
+		return "", fmt.Errorf("%w: %q", ErrNotUnixSocket, address)
+	} else {
+		return path, nil
+	}
+}
+
+// loadCertPool reads a PEM encoded certificate bundle
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCertificates, path)
+	}
+
+	return pool, nil
+}
+
+// remoteHandshake returns a [service.Listener] handshake which completes the
+// TLS handshake (verifying the client certificate if required), and reads the
+// token if one is given. The returned connection replays any client messages
+// which were read along with the token.
+func remoteHandshake(token string) func(ctx context.Context, conn net.Conn) (io.ReadWriteCloser, error) {
+	return func(ctx context.Context, conn net.Conn) (io.ReadWriteCloser, error) {
+		conn.SetDeadline(time.Now().Add(remoteAuthTimeout))
+		defer conn.SetDeadline(time.Time{})
+
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if token == "" {
+			return conn, nil
+		}
+
+		var (
+			hello   remoteHello
+			decoder = json.NewDecoder(conn)
+		)
+
+		if err := decoder.Decode(&hello); err != nil {
+			return nil, err
+		} else if subtle.ConstantTimeCompare([]byte(hello.Token), []byte(token)) != 1 {
+			return nil, ErrInvalidToken
+		}
+
+		return &remoteConn{Conn: conn, reader: io.MultiReader(decoder.Buffered(), conn)}, nil
+	}
+}
+
+// remoteConn is a connection whose reads start with data which was already
+// buffered while authenticating.
+type remoteConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *remoteConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// dialService connects to the service at the configured socket address. For
+// remote addresses, the connection is authenticated with the configured
+// token and client certificate.
+func dialService(cfg *Config) (net.Conn, error) {
+	scheme, addr, err := parseSocketAddress(cfg.SocketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer = net.Dialer{Timeout: remoteDialTimeout}
+
+	switch scheme {
+	case schemeUnix:
+		return dialer.Dial("unix", addr)
+	case schemeTCP:
+		conn, err := dialer.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return sendRemoteHello(conn, cfg.Remote.Token)
+	default:
+		tlsConfig := &tls.Config{
+			ServerName: cfg.Remote.ServerName,
+			MinVersion: tls.VersionTLS12,
+		}
+
+		if cfg.Remote.CA != "" {
+			if tlsConfig.RootCAs, err = loadCertPool(cfg.Remote.CA); err != nil {
+				return nil, err
+			}
+		}
+
+		if cfg.Remote.Cert != "" || cfg.Remote.Key != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.Remote.Cert, cfg.Remote.Key)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		conn, err := tls.DialWithDialer(&dialer, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return sendRemoteHello(conn, cfg.Remote.Token)
+	}
+}
+
+// sendRemoteHello sends the token to the service, if one is configured
+func sendRemoteHello(conn net.Conn, token string) (net.Conn, error) {
+	if token == "" {
+		return conn, nil
+	}
+
+	if err := json.NewEncoder(conn).Encode(remoteHello{Token: token}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
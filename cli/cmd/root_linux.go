@@ -1,8 +1,24 @@
 package cmd
 
-import "github.com/spf13/viper"
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/viper"
+)
 
 func init() {
-	rootCmd.PersistentFlags().String("socket", "/run/embermug.sock", "Default Unix Socket Path")
+	rootCmd.PersistentFlags().String("socket", defaultSocketPath(), "Default Unix Socket Path")
 	viper.BindPFlag("socket-path", rootCmd.PersistentFlags().Lookup("socket"))
 }
+
+// defaultSocketPath returns the socket path used when none is configured. A
+// service running as root uses the system runtime directory, and user services
+// use the user runtime directory ($XDG_RUNTIME_DIR).
+func defaultSocketPath() string {
+	if os.Getuid() == 0 {
+		return "/run/embermug.sock"
+	}
+	return filepath.Join(xdg.RuntimeDir, "embermug.sock")
+}
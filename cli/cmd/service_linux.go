@@ -2,19 +2,19 @@ package cmd
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/history"
 	"github.com/calebstewart/go-embermug/service"
 
-	"github.com/coreos/go-systemd/v22/activation"
-	"github.com/esiqveland/notify"
-	"github.com/godbus/dbus/v5"
+	"github.com/adrg/xdg"
+	"github.com/coreos/go-systemd/v22/daemon"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"tinygo.org/x/bluetooth"
@@ -36,8 +36,21 @@ settings such as the set point temperature or device color.
 
 func init() {
 	flags := serviceCommand.Flags()
-	flags.Bool("enable-notifications", false, "Send a desktop notification when the target temperature is reached")
+	flags.Bool("enable-notifications", false, "Send desktop notifications for the configured notification rules")
 	viper.BindPFlag("service.enable-notifications", flags.Lookup("enable-notifications"))
+	flags.Bool("enable-dbus", false, "Export the mug on the D-Bus session bus")
+	viper.BindPFlag("service.enable-dbus", flags.Lookup("enable-dbus"))
+
+	viper.SetDefault("service.poll.interval", time.Minute)
+	viper.SetDefault("service.poll.idle-interval", 5*time.Minute)
+	viper.SetDefault("service.history.max-size", history.DefaultMaxSize)
+	viper.SetDefault("service.history.retention", 90*24*time.Hour)
+	viper.SetDefault("service.sync-clock", true)
+	viper.SetDefault("service.battery-low", 20)
+	viper.SetDefault("service.hook-concurrency", 4)
+	viper.SetDefault("service.mqtt.topic-prefix", "embermug")
+	viper.SetDefault("service.mqtt.discovery", true)
+	viper.SetDefault("service.mqtt.discovery-prefix", "homeassistant")
 
 	rootCmd.AddCommand(&serviceCommand)
 }
@@ -45,9 +58,8 @@ func init() {
 func serviceEntrypoint(cmd *cobra.Command, args []string) error {
 	var (
 		cfg         Config
-		ctx, cancel = signal.NotifyContext(context.Background(), os.Kill, os.Interrupt)
+		ctx, cancel = signal.NotifyContext(context.Background(), os.Kill, os.Interrupt, syscall.SIGTERM)
 		svc         *service.Service
-		listener    net.Listener
 	)
 	defer cancel()
 
@@ -60,33 +72,90 @@ func serviceEntrypoint(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if addr, err := ParseAddress(cfg.Service.DeviceAddress); err != nil {
-		slog.Error("Invalid device address", "Address", cfg.Service.DeviceAddress, "Error", err)
+	options := []service.Option{
+		service.WithPolling(service.PollConfig{
+			Interval:     cfg.Service.Poll.Interval,
+			IdleInterval: cfg.Service.Poll.IdleInterval,
+		}),
+	}
+
+	if path, err := xdg.StateFile("embermug/battery.json"); err != nil {
+		slog.Warn("Could not locate battery estimate file. Estimates will not persist.", "Error", err)
 	} else {
-		svc = service.New(bluetooth.DefaultAdapter, addr)
+		options = append(options, service.WithBatteryEstimates(path))
 	}
 
-	if listeners, err := activation.Listeners(); err != nil {
-		slog.Error("Could not find systemd activation listeners", "Error", err)
+	options = append(options, service.WithSessions(sessionsFile()))
+
+	if cfg.Service.SyncClock {
+		options = append(options, service.WithClockSync())
+	}
+
+	presets, err := cfg.ServicePresets()
+	if err != nil {
+		slog.Error("Invalid preset configuration", "Error", err)
+		return err
+	}
+	options = append(options, service.WithPresets(presets...))
+
+	if rules, err := cfg.ServiceSchedule(presets); err != nil {
+		slog.Error("Invalid schedule configuration", "Error", err)
 		return err
-	} else if len(listeners) > 0 {
-		listener = listeners[0]
-		for _, l := range listeners[1:] {
-			l.Close()
-		}
-		slog.Info("Received SystemD Activation Listener", "Addr", listener.Addr())
 	} else {
-		slog.Warn("No systemd sockets found")
-		slog.Warn("Listening on default socket path", "Path", cfg.SocketPath)
+		options = append(options, service.WithSchedule(rules...))
+	}
 
-		if l, err := net.Listen("unix", cfg.SocketPath); err != nil {
-			slog.Error("Could not open unix socket", "Path", cfg.SocketPath, "Error", err)
-			return err
-		} else {
-			listener = l
-		}
+	if cfg.Service.ScheduleCatchUp {
+		options = append(options, service.WithScheduleCatchUp())
+	}
+
+	if rules, err := cfg.ServiceAccessRules(); err != nil {
+		slog.Error("Invalid access configuration", "Error", err)
+		return err
+	} else {
+		options = append(options, service.WithAccessRules(rules...))
+	}
+
+	// Checked before the listeners are opened, which consumes the activation
+	if idleExitEnabled(&cfg.Service) {
+		slog.Info("Exiting when idle", "IdleExit", cfg.Service.IdleExit)
+		options = append(options, service.WithIdleTimeout(cfg.Service.IdleExit))
+	}
+
+	notificationRules, err := compileNotificationRules(cfg.Service.Notifications)
+	if err != nil {
+		slog.Error("Invalid notification configuration", "Error", err)
+		return err
+	}
+
+	if err := validateHooks(cfg.Service.Hooks); err != nil {
+		slog.Error("Invalid hook configuration", "Error", err)
+		return err
+	}
+
+	webhooks, err := compileWebhooks(cfg.Service.Webhooks)
+	if err != nil {
+		slog.Error("Invalid webhook configuration", "Error", err)
+		return err
+	}
+
+	if addr, err := ParseAddress(cfg.Service.DeviceAddress); err != nil {
+		slog.Error("Invalid device address", "Address", cfg.Service.DeviceAddress, "Error", err)
+		return err
+	} else {
+		svc = service.New(bluetooth.DefaultAdapter, addr, options...)
 	}
-	defer listener.Close()
+
+	listeners, err := serviceListeners(&cfg)
+	if err != nil {
+		slog.Error("Could not open listeners", "Error", err)
+		return err
+	}
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
 
 	slog.Info("Enabling Default Bluetooth Adapter")
 	if err := bluetooth.DefaultAdapter.Enable(); err != nil {
@@ -95,52 +164,95 @@ func serviceEntrypoint(cmd *cobra.Command, args []string) error {
 	}
 
 	if cfg.Service.EnableNotifications {
-		// Start a client which will notify the desktop when the temp is reached
-		go notifierClient(svc.RegisterClient(ctx))
+		// Start a client which will notify the desktop when notification rules fire
+		go notifierClient(svc, svc.RegisterClient(ctx), notificationRules)
 	}
 
-	slog.Info("Starting Ember Mug Monitor")
-	if err := svc.Run(ctx, listener); err != nil {
-		slog.Error("Service failed", "Error", err)
-		return err
+	if cfg.Service.History.Enabled {
+		if store, err := history.Open(historyDirectory(), history.Options{
+			MaxSize:   cfg.Service.History.MaxSize,
+			Retention: cfg.Service.History.Retention,
+		}); err != nil {
+			slog.Error("Could not open history store. History Disabled.", "Error", err)
+		} else {
+			go historyClient(svc.RegisterClient(ctx), store)
+		}
 	}
 
-	return nil
-}
+	if len(cfg.Service.Hooks) > 0 {
+		// Start a client which runs hook commands on state transitions
+		go hookClient(svc.RegisterClient(ctx), cfg.Service.Hooks, cfg.Service.HookConcurrency, cfg.Service.BatteryLow)
+	}
 
-func notifierClient(client *service.Client) {
-	var (
-		lastState embermug.State
-		logger    = slog.With("ClientID", client.ID)
-	)
+	if len(webhooks) > 0 {
+		// Start a client which posts state transitions to the configured webhooks
+		go webhookClient(svc.RegisterClient(ctx), webhooks, cfg.Service.BatteryLow)
+	}
 
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		logger.Error("Could not open private bus. Notifications Disabled.", "Error", err)
-		return
-	}
-	defer conn.Close()
-
-	logger.Info("Notification Client Started")
-
-	for {
-		select {
-		case <-client.Context.Done():
-			return
-		case state := <-client.Channel:
-			if lastState != state.State && state.State == embermug.StateStable {
-				logger.Debug("Sending desktop notification for stable temperature")
-				_, err := notify.SendNotification(conn, notify.Notification{
-					AppName:       "Ember Mug",
-					Summary:       "Ember Mug Optimal Temperature Reached!",
-					Body:          fmt.Sprintf("Your Ember Mug has reached its target optimal temperature of %v!", int(state.Target.Fahrenheit())),
-					ExpireTimeout: time.Second * 5,
-				})
-				if err != nil {
-					logger.Error("Could not deliver notification", "Error", err)
-				}
-			}
-			lastState = state.State
+	if cfg.Service.MQTT.Broker != "" {
+		// Start a client which bridges the mug state and commands to MQTT
+		bridge := newMQTTBridge(svc, cfg.Service.MQTT, mqttDeviceID(cfg.Service.DeviceAddress), presets)
+		go mqttClient(svc.RegisterClient(ctx), bridge)
+	}
+
+	if cfg.Service.EnableDBus {
+		// Start a client which exports the mug on the session bus
+		go dbusClient(svc, svc.RegisterClient(ctx), cfg.Service.DeviceAddress, cfg.Service.DBusBattery)
+	} else if cfg.Service.DBusBattery {
+		slog.Warn("The D-Bus battery requires the D-Bus interface. D-Bus Battery Disabled.")
+	}
+
+	if cfg.Service.Metrics.Listen != "" {
+		metricsListener, err := net.Listen("tcp", cfg.Service.Metrics.Listen)
+		if err != nil {
+			slog.Error("Could not open metrics listener", "Addr", cfg.Service.Metrics.Listen, "Error", err)
+			return err
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metricsHandler(svc))
+		go serveHTTP(ctx, &http.Server{Handler: mux, ReadHeaderTimeout: httpReadHeaderTimeout}, metricsListener, "metrics")
+	}
+
+	if cfg.Service.HTTP.Listen != "" {
+		httpListener, err := net.Listen("tcp", cfg.Service.HTTP.Listen)
+		if err != nil {
+			slog.Error("Could not open HTTP listener", "Addr", cfg.Service.HTTP.Listen, "Error", err)
+			return err
 		}
+
+		if cfg.Service.HTTP.Token == "" && !loopbackListener(httpListener) {
+			httpListener.Close()
+			slog.Error("Refusing to serve the HTTP API without a token", "Addr", cfg.Service.HTTP.Listen, "Error", ErrHTTPAuthRequired)
+			return ErrHTTPAuthRequired
+		} else if cfg.Service.HTTP.Token == "" {
+			slog.Warn("HTTP API authentication is disabled", "Addr", cfg.Service.HTTP.Listen)
+		}
+
+		api := &httpAPI{svc: svc, token: cfg.Service.HTTP.Token, lowBattery: cfg.Service.BatteryLow}
+		go serveHTTP(ctx, &http.Server{
+			Handler:           api.Handler(),
+			ReadHeaderTimeout: httpReadHeaderTimeout,
+			// Requests (and event streams) end when the service stops
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}, httpListener, "api")
 	}
+
+	if os.Getenv("NOTIFY_SOCKET") != "" {
+		// Report the connection state and health to systemd
+		go systemdStatusClient(svc, svc.RegisterClient(ctx))
+		go systemdWatchdog(ctx, svc)
+	}
+
+	// The listeners are open, so clients are queued until the service runs
+	sdNotify(daemon.SdNotifyReady)
+	defer sdNotify(daemon.SdNotifyStopping)
+
+	slog.Info("Starting Ember Mug Monitor")
+	if err := svc.Run(ctx, listeners...); err != nil {
+		slog.Error("Service failed", "Error", err)
+		return err
+	}
+
+	return nil
 }
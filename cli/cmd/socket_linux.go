@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+var (
+	ErrSocketInUse = errors.New("socket is in use by another process")
+	ErrNotASocket  = errors.New("path exists and is not a socket")
+	ErrInvalidMode = errors.New("invalid socket mode: expected an octal mode such as '0660'")
+)
+
+// socketOptions controls the permissions of a unix socket created by the service
+type socketOptions struct {
+	mode  os.FileMode // Permissions of the socket (zero leaves the permissions from the umask)
+	group int         // Group owning the socket (-1 leaves the group unchanged)
+}
+
+// parseSocketOptions validates the configured socket mode and group
+func parseSocketOptions(mode, group string) (options socketOptions, err error) {
+	options.group = -1
+
+	if mode != "" {
+		if value, err := strconv.ParseUint(mode, 8, 32); err != nil || value > 0o777 {
+			return options, fmt.Errorf("%w: %q", ErrInvalidMode, mode)
+		} else {
+			options.mode = os.FileMode(value)
+		}
+	}
+
+	if group != "" {
+		if gid, err := lookupGroupID(group); err != nil {
+			return options, fmt.Errorf("socket group %q: %w", group, err)
+		} else {
+			options.group = int(gid)
+		}
+	}
+
+	return options, nil
+}
+
+// listenUnixSocket opens a unix socket at the given path. A stale socket left
+// behind by a service which did not shut down cleanly is removed, but a socket
+// which still accepts connections is left alone. The socket is removed again
+// when the listener is closed.
+func listenUnixSocket(path string, options socketOptions) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	// Create the socket accessible only by the owner, so other users cannot
+	// connect before the configured mode is applied. The umask is process
+	// wide, but listeners are opened before the service starts any other
+	// goroutines.
+	if options.mode != 0 {
+		defer syscall.Umask(syscall.Umask(0o177))
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(true)
+
+	if options.mode != 0 {
+		if err := os.Chmod(path, options.mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	if options.group != -1 {
+		if err := os.Chown(path, -1, options.group); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket at the given path if no process is
+// listening on it. Missing paths are ignored.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%w: %v", ErrNotASocket, path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %v", ErrSocketInUse, path)
+	} else if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+
+	slog.Warn("Removing stale socket", "Path", path)
+	return os.Remove(path)
+}
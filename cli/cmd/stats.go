@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/spf13/cobra"
+)
+
+var statsCommand = cobra.Command{
+	Use:   "stats",
+	Short: "Show drink session statistics",
+	Long: `Show drink session statistics
+
+The service detects "drink sessions" which start when the mug is filled
+and end when the mug is emptied. Completed sessions are recorded under
+$XDG_STATE_HOME/embermug/sessions.ndjson. This command summarizes the
+recorded sessions per day or per week.
+
+The --since and --until flags accept either an RFC3339 timestamp, a date
+(YYYY-MM-DD) or a duration relative to now (e.g. '168h').
+`,
+	Args: cobra.ExactArgs(0),
+	Run:  commandExitWrapper(statsEntrypoint),
+}
+
+func init() {
+	flags := statsCommand.Flags()
+	flags.String("since", "168h", "Only include sessions started at or after this time")
+	flags.String("until", "", "Only include sessions started before this time")
+	flags.Bool("weekly", false, "Summarize sessions per week instead of per day")
+	flags.Bool("sessions", false, "List individual sessions instead of summaries")
+
+	rootCmd.AddCommand(&statsCommand)
+}
+
+// sessionsFile returns the path where the service records drink sessions
+func sessionsFile() string {
+	return filepath.Join(xdg.StateHome, "embermug", "sessions.ndjson")
+}
+
+// sessionSummary aggregates the drink sessions within a single period
+type sessionSummary struct {
+	Period           string
+	Sessions         int
+	Refills          int
+	FillTemperature  embermug.Temperature // Sum of fill temperatures
+	TimeAtTarget     time.Duration
+	TimeToStable     time.Duration // Sum of time between fill and first stable
+	ReachedStable    int           // Number of sessions which reached the target
+	TimeBetweenFills time.Duration // Sum of time between consecutive session starts
+	Gaps             int           // Number of consecutive session pairs
+	lastStart        time.Time
+}
+
+func (s *sessionSummary) add(session service.Session) {
+	s.Sessions += 1
+	s.Refills += session.Refills
+	s.FillTemperature += session.FillTemperature
+	s.TimeAtTarget += session.TimeAtTarget
+
+	if !session.FirstStable.IsZero() {
+		s.TimeToStable += session.FirstStable.Sub(session.Start)
+		s.ReachedStable += 1
+	}
+
+	if !s.lastStart.IsZero() {
+		s.TimeBetweenFills += session.Start.Sub(s.lastStart)
+		s.Gaps += 1
+	}
+	s.lastStart = session.Start
+}
+
+func statsEntrypoint(cmd *cobra.Command, args []string) error {
+	var (
+		flags    = cmd.Flags()
+		now      = time.Now()
+		sessions []service.Session
+	)
+
+	since, err := parseTimeArgument(flags.Lookup("since").Value.String(), now)
+	if err != nil {
+		slog.Error("Invalid start time", "Error", err)
+		return err
+	}
+
+	until, err := parseTimeArgument(flags.Lookup("until").Value.String(), now)
+	if err != nil {
+		slog.Error("Invalid end time", "Error", err)
+		return err
+	}
+
+	weekly, _ := flags.GetBool("weekly")
+	list, _ := flags.GetBool("sessions")
+
+	for session, err := range service.ReadSessions(sessionsFile()) {
+		if err != nil {
+			slog.Error("Could not read drink sessions", "Error", err)
+			return err
+		} else if !since.IsZero() && session.Start.Before(since) {
+			continue
+		} else if !until.IsZero() && !session.Start.Before(until) {
+			continue
+		} else {
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b service.Session) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	if list {
+		writeSessions(os.Stdout, sessions)
+	} else {
+		writeSessionSummaries(os.Stdout, summarizeSessions(sessions, weekly))
+	}
+
+	return nil
+}
+
+// summarizeSessions groups the (sorted) sessions by day or by ISO week
+func summarizeSessions(sessions []service.Session, weekly bool) []*sessionSummary {
+	var (
+		summaries []*sessionSummary
+		current   *sessionSummary
+	)
+
+	for _, session := range sessions {
+		var (
+			start  = session.Start.Local()
+			period = start.Format(time.DateOnly)
+		)
+
+		if weekly {
+			year, week := start.ISOWeek()
+			period = fmt.Sprintf("%04d-W%02d", year, week)
+		}
+
+		if current == nil || current.Period != period {
+			current = &sessionSummary{Period: period}
+			summaries = append(summaries, current)
+		}
+
+		current.add(session)
+	}
+
+	return summaries
+}
+
+func writeSessionSummaries(stream io.Writer, summaries []*sessionSummary) {
+	var writer = tabwriter.NewWriter(stream, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "PERIOD\tSESSIONS\tREFILLS\tAVG FILL TEMP\tAVG FILL TO STABLE\tAVG BETWEEN FILLS\tTIME AT TARGET")
+
+	for _, s := range summaries {
+		var (
+			fillTemp     = embermug.Temperature(float64(s.FillTemperature) / float64(s.Sessions))
+			toStable     = "-"
+			betweenFills = "-"
+		)
+
+		if s.ReachedStable > 0 {
+			toStable = formatDuration(s.TimeToStable / time.Duration(s.ReachedStable))
+		}
+		if s.Gaps > 0 {
+			betweenFills = formatDuration(s.TimeBetweenFills / time.Duration(s.Gaps))
+		}
+
+		fmt.Fprintf(
+			writer,
+			"%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			s.Period,
+			s.Sessions,
+			s.Refills,
+			formatTemperature(fillTemp),
+			toStable,
+			betweenFills,
+			formatSessionDuration(s.TimeAtTarget),
+		)
+	}
+}
+
+func writeSessions(stream io.Writer, sessions []service.Session) {
+	var writer = tabwriter.NewWriter(stream, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "START\tDURATION\tREFILLS\tFILL TEMP\tFILL TO STABLE\tTIME AT TARGET")
+
+	for _, session := range sessions {
+		var toStable = "-"
+		if !session.FirstStable.IsZero() {
+			toStable = formatDuration(session.FirstStable.Sub(session.Start))
+		}
+
+		fmt.Fprintf(
+			writer,
+			"%v\t%v\t%v\t%v\t%v\t%v\n",
+			session.Start.Local().Format(time.DateTime),
+			formatSessionDuration(session.End.Sub(session.Start)),
+			session.Refills,
+			formatTemperature(session.FillTemperature),
+			toStable,
+			formatSessionDuration(session.TimeAtTarget),
+		)
+	}
+}
+
+// formatSessionDuration formats a duration for the statistics tables, using
+// a placeholder for zero durations.
+func formatSessionDuration(d time.Duration) string {
+	if value := formatDuration(d); value != "" {
+		return value
+	}
+	return "-"
+}
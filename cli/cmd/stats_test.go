@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+func TestSummarizeSessions(t *testing.T) {
+	var (
+		at = func(month time.Month, day, hour int) time.Time {
+			return time.Date(2024, month, day, hour, 0, 0, 0, time.Local)
+		}
+		// Sunday and Monday either side of the 2025 ISO week boundary
+		sessions = []service.Session{
+			{Start: at(time.December, 29, 8), FillTemperature: embermug.Celsius(60), FirstStable: at(time.December, 29, 8).Add(5 * time.Minute), TimeAtTarget: 10 * time.Minute},
+			{Start: at(time.December, 29, 23), FillTemperature: embermug.Celsius(70), Refills: 2},
+			{Start: at(time.December, 30, 1), FillTemperature: embermug.Celsius(50), FirstStable: at(time.December, 30, 1).Add(15 * time.Minute)},
+			{Start: at(time.December, 30, 9), FillTemperature: embermug.Celsius(60), TimeAtTarget: 20 * time.Minute},
+			{Start: at(time.December, 31, 9), FillTemperature: embermug.Celsius(60)},
+		}
+	)
+
+	tests := []struct {
+		name     string
+		weekly   bool
+		expected []sessionSummary
+	}{
+		{
+			name: "daily",
+			expected: []sessionSummary{
+				{
+					Period:           "2024-12-29",
+					Sessions:         2,
+					Refills:          2,
+					FillTemperature:  embermug.Celsius(60) + embermug.Celsius(70),
+					TimeAtTarget:     10 * time.Minute,
+					TimeToStable:     5 * time.Minute,
+					ReachedStable:    1,
+					TimeBetweenFills: 15 * time.Hour,
+					Gaps:             1,
+				},
+				{
+					Period:           "2024-12-30",
+					Sessions:         2,
+					FillTemperature:  embermug.Celsius(50) + embermug.Celsius(60),
+					TimeAtTarget:     20 * time.Minute,
+					TimeToStable:     15 * time.Minute,
+					ReachedStable:    1,
+					TimeBetweenFills: 8 * time.Hour,
+					Gaps:             1,
+				},
+				{
+					Period:          "2024-12-31",
+					Sessions:        1,
+					FillTemperature: embermug.Celsius(60),
+				},
+			},
+		},
+		{
+			name:   "weekly",
+			weekly: true,
+			expected: []sessionSummary{
+				{
+					Period:           "2024-W52",
+					Sessions:         2,
+					Refills:          2,
+					FillTemperature:  embermug.Celsius(60) + embermug.Celsius(70),
+					TimeAtTarget:     10 * time.Minute,
+					TimeToStable:     5 * time.Minute,
+					ReachedStable:    1,
+					TimeBetweenFills: 15 * time.Hour,
+					Gaps:             1,
+				},
+				{
+					// December 30th 2024 is in the first ISO week of 2025
+					Period:           "2025-W01",
+					Sessions:         3,
+					FillTemperature:  embermug.Celsius(50) + embermug.Celsius(60) + embermug.Celsius(60),
+					TimeAtTarget:     20 * time.Minute,
+					TimeToStable:     15 * time.Minute,
+					ReachedStable:    1,
+					TimeBetweenFills: 32 * time.Hour,
+					Gaps:             2,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			summaries := summarizeSessions(sessions, test.weekly)
+			if len(summaries) != len(test.expected) {
+				t.Fatalf("%v summaries, expected %v", len(summaries), len(test.expected))
+			}
+
+			for index, summary := range summaries {
+				// Only the gaps within a period are summed
+				summary.lastStart = time.Time{}
+				if *summary != test.expected[index] {
+					t.Errorf("summary %v = %+v, expected %+v", index, *summary, test.expected[index])
+				}
+			}
+		})
+	}
+
+	if summaries := summarizeSessions(nil, false); len(summaries) != 0 {
+		t.Errorf("summaries = %v without sessions", summaries)
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// sdNotify sends a state to the service manager. It does nothing when the
+// service was not started by systemd with a notification socket.
+func sdNotify(state string) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		slog.Warn("Could not notify service manager", "State", state, "Error", err)
+	}
+}
+
+// systemdStatus describes the state for the service manager STATUS= field
+func systemdStatus(state service.State) string {
+	if !state.Connected {
+		return "Waiting for mug"
+	}
+
+	var name = state.Name
+	if name == "" {
+		name = "Ember Mug"
+	}
+
+	return fmt.Sprintf("Connected to %v, %.0f°C", name, state.Current.Celsius())
+}
+
+// systemdStatusClient reports the connection state to the service manager
+// until the client context is cancelled.
+func systemdStatusClient(svc *service.Service, client *service.Client) {
+	var status = systemdStatus(svc.State())
+	sdNotify("STATUS=" + status)
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			if next := systemdStatus(state); next != status {
+				status = next
+				sdNotify("STATUS=" + status)
+			}
+		}
+	}
+}
+
+// systemdWatchdog sends watchdog pings at half the watchdog interval while
+// the bluetooth event loop is responsive, so the service manager restarts
+// the service once it is wedged. It does nothing if the watchdog is disabled.
+func systemdWatchdog(ctx context.Context, svc *service.Service) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		slog.Warn("Invalid watchdog configuration", "Error", err)
+		return
+	} else if interval == 0 {
+		return
+	}
+
+	var ticker = time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	slog.Info("Watchdog Enabled", "Interval", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if svc.Responsive(interval / 4) {
+				sdNotify(daemon.SdNotifyWatchdog)
+			} else {
+				slog.Error("Bluetooth event loop is not responding. Withholding watchdog ping.")
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+// Transition names a change between two consecutive service states which
+// integrations (such as hooks) can react to.
+type Transition string
+
+const (
+	TransitionConnected       Transition = "connected"        // Mug connected
+	TransitionDisconnected    Transition = "disconnected"     // Mug disconnected
+	TransitionEmpty           Transition = "empty"            // Mug was emptied
+	TransitionFilling         Transition = "filling"          // Mug is being filled
+	TransitionHeating         Transition = "heating"          // Mug started heating
+	TransitionCooling         Transition = "cooling"          // Mug started cooling
+	TransitionStable          Transition = "stable"           // Mug reached the target temperature
+	TransitionBatteryLow      Transition = "battery-low"      // Battery dropped to the low battery threshold while discharging
+	TransitionChargingStarted Transition = "charging-started" // Mug was placed on the charger
+	TransitionChargingStopped Transition = "charging-stopped" // Mug was removed from the charger
+)
+
+var ErrInvalidTransition = errors.New("invalid transition")
+
+// transitionByState maps mug liquid states to the transition reported when
+// the mug enters that state.
+var transitionByState = map[embermug.State]Transition{
+	embermug.StateEmpty:   TransitionEmpty,
+	embermug.StateFilling: TransitionFilling,
+	embermug.StateHeating: TransitionHeating,
+	embermug.StateCooling: TransitionCooling,
+	embermug.StateStable:  TransitionStable,
+}
+
+var allTransitions = []Transition{
+	TransitionConnected,
+	TransitionDisconnected,
+	TransitionEmpty,
+	TransitionFilling,
+	TransitionHeating,
+	TransitionCooling,
+	TransitionStable,
+	TransitionBatteryLow,
+	TransitionChargingStarted,
+	TransitionChargingStopped,
+}
+
+// validateTransitions returns an error if any of the given transitions is unknown
+func validateTransitions(transitions []Transition) error {
+	for _, transition := range transitions {
+		if !slices.Contains(allTransitions, transition) {
+			return fmt.Errorf("%w: %q", ErrInvalidTransition, transition)
+		}
+	}
+
+	return nil
+}
+
+// detectTransitions returns the transitions between the previous and current
+// state. A battery at or below lowBattery percent is considered low.
+func detectTransitions(previous, current service.State, lowBattery int) []Transition {
+	var transitions []Transition
+
+	if !current.Connected {
+		if previous.Connected {
+			transitions = append(transitions, TransitionDisconnected)
+		}
+		return transitions
+	}
+
+	if !previous.Connected {
+		transitions = append(transitions, TransitionConnected)
+	}
+
+	if current.State != previous.State {
+		if transition, ok := transitionByState[current.State]; ok {
+			transitions = append(transitions, transition)
+		}
+	}
+
+	if previous.Connected {
+		if current.Battery.Charging && !previous.Battery.Charging {
+			transitions = append(transitions, TransitionChargingStarted)
+		} else if !current.Battery.Charging && previous.Battery.Charging {
+			transitions = append(transitions, TransitionChargingStopped)
+		}
+
+		if !current.Battery.Charging && current.Battery.Charge <= lowBattery && previous.Battery.Charge > lowBattery {
+			transitions = append(transitions, TransitionBatteryLow)
+		}
+	}
+
+	return transitions
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/calebstewart/go-embermug/service"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	dbusBatteryPath   = dbus.ObjectPath("/io/github/embermug/Battery")
+	upowerDeviceIface = "org.freedesktop.UPower.Device"
+)
+
+// UPower device types and battery states used by the battery object. See the
+// org.freedesktop.UPower.Device documentation for the complete lists.
+const (
+	upowerTypeBluetoothGeneric = 28
+
+	upowerStateUnknown      = 0
+	upowerStateCharging     = 1
+	upowerStateDischarging  = 2
+	upowerStateEmpty        = 3
+	upowerStateFullyCharged = 4
+
+	upowerLevelNone = 1 // The percentage should be used instead of a coarse level
+)
+
+// upowerBatteryState returns the UPower battery state for the service state
+func upowerBatteryState(state service.State) uint32 {
+	switch {
+	case !state.Connected:
+		return upowerStateUnknown
+	case state.Battery.Charging && state.Battery.Charge >= 100:
+		return upowerStateFullyCharged
+	case state.Battery.Charging:
+		return upowerStateCharging
+	case state.Battery.Charge <= 0:
+		return upowerStateEmpty
+	default:
+		return upowerStateDischarging
+	}
+}
+
+// upowerIconName returns the battery icon name in the same format as UPower
+func upowerIconName(state service.State) string {
+	if !state.Connected {
+		return "battery-missing-symbolic"
+	}
+
+	if upowerBatteryState(state) == upowerStateFullyCharged {
+		return "battery-full-charged-symbolic"
+	}
+
+	var level string
+	switch charge := state.Battery.Charge; {
+	case charge < 10:
+		level = "caution"
+	case charge < 30:
+		level = "low"
+	case charge < 60:
+		level = "good"
+	default:
+		level = "full"
+	}
+
+	if state.Battery.Charging {
+		return fmt.Sprintf("battery-%v-charging-symbolic", level)
+	}
+	return fmt.Sprintf("battery-%v-symbolic", level)
+}
+
+// upowerDeviceProperties returns the values of the UPower device properties
+// for the given state. The time estimates are only reported while they apply,
+// matching UPower.
+func upowerDeviceProperties(state service.State, address string) map[string]any {
+	var (
+		batteryState = upowerBatteryState(state)
+		timeToEmpty  int64
+		timeToFull   int64
+	)
+
+	switch batteryState {
+	case upowerStateDischarging:
+		timeToEmpty = int64(state.TimeToEmpty.Seconds())
+	case upowerStateCharging:
+		timeToFull = int64(state.TimeToFull.Seconds())
+	}
+
+	return map[string]any{
+		"NativePath":     address,
+		"Vendor":         "Ember",
+		"Model":          state.Name,
+		"Serial":         address,
+		"Type":           uint32(upowerTypeBluetoothGeneric),
+		"PowerSupply":    false,
+		"Online":         false,
+		"IsPresent":      state.Connected,
+		"IsRechargeable": true,
+		"HasHistory":     false,
+		"HasStatistics":  false,
+		"Percentage":     float64(state.Battery.Charge),
+		"State":          batteryState,
+		"BatteryLevel":   uint32(upowerLevelNone),
+		"TimeToEmpty":    timeToEmpty,
+		"TimeToFull":     timeToFull,
+		"Temperature":    state.Battery.Temperature.Celsius(),
+		"IconName":       upowerIconName(state),
+	}
+}
@@ -33,14 +33,7 @@ func NewWaybarBlock(cfg *WaybarBlockConfig) (*WaybarBlock, error) {
 		block = WaybarBlock{
 			Percentage: cfg.Percentage,
 		}
-		funcs = template.FuncMap{
-			"toFahrenheit": func(t embermug.Temperature) int {
-				return int(t.Fahrenheit())
-			},
-			"toCelsius": func(t embermug.Temperature) int {
-				return int(t.Celsius())
-			},
-		}
+		funcs = templateFuncs()
 	)
 
 	if tooltip, err := template.New("tooltip").Funcs(funcs).Parse(cfg.ToolTip); err != nil {
@@ -178,6 +171,7 @@ func NewWaybarEncoder(cfg *WaybarConfig, stream io.Writer) (*WaybarEncoder, erro
 		if block, err := NewWaybarBlock(&WaybarBlockConfig{
 			Text: "{{ .State }} ({{ toFahrenheit .Current }}F/{{ toFahrenheit .Target }}F)",
 			ToolTip: strings.Join([]string{
+				"{{ if .ETA }}Ready in {{ eta .ETA }}{{ else }}Estimating time to target{{ end }}",
 				"Battery: {{ .Battery.Charge }}% ({{if .Battery.Charging}}charging{{else}}discharging{{end}})",
 			}, "\n"),
 		}); err != nil {
@@ -268,9 +262,9 @@ func waybarEntrypoint(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	conn, err := net.Dial("unix", cfg.SocketPath)
+	conn, err := dialService(&cfg)
 	if err != nil {
-		slog.Error("Could not connect to socket", "Path", cfg.SocketPath, "Error", err)
+		slog.Error("Could not connect to service", "Address", cfg.SocketPath, "Error", err)
 		return err
 	}
 	defer conn.Close()
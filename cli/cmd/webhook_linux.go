@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/calebstewart/go-embermug/service"
+)
+
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	defaultWebhookRetries = 3
+	defaultWebhookBackoff = time.Second
+
+	// webhookQueueSize is the number of payloads waiting for delivery to a
+	// single endpoint before new payloads are dropped.
+	webhookQueueSize = 16
+
+	// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the
+	// request body when the webhook has a secret.
+	WebhookSignatureHeader = "X-Embermug-Signature"
+)
+
+var ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute http or https URL")
+
+// webhookPayload is the object sent to webhook endpoints, and the object used
+// to execute webhook body templates.
+type webhookPayload struct {
+	Time        time.Time                 // Time the transition was observed
+	Transitions []Transition              // Transitions which triggered the webhook
+	State       service.State             // Current mug state
+	Changes     map[string]service.Change // State fields which changed since the previous update
+}
+
+// webhook is a compiled [WebhookConfig] with its delivery queue
+type webhook struct {
+	config WebhookConfig
+	body   *template.Template
+	queue  chan webhookPayload
+	client http.Client
+}
+
+// newWebhook validates the webhook configuration, and fills in defaults
+func newWebhook(cfg WebhookConfig) (*webhook, error) {
+	var hook = &webhook{
+		config: cfg,
+		queue:  make(chan webhookPayload, webhookQueueSize),
+	}
+
+	if u, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebhookURL, err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidWebhookURL, cfg.URL)
+	}
+
+	if err := validateTransitions(cfg.On); err != nil {
+		return nil, err
+	}
+
+	if cfg.Body != "" {
+		funcs := templateFuncs()
+		funcs["json"] = func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		}
+
+		if body, err := template.New("body").Funcs(funcs).Parse(cfg.Body); err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		} else {
+			hook.body = body
+		}
+	}
+
+	if hook.config.ContentType == "" {
+		hook.config.ContentType = "application/json"
+	}
+	if hook.config.Timeout <= 0 {
+		hook.config.Timeout = defaultWebhookTimeout
+	}
+	if hook.config.Retries == 0 {
+		hook.config.Retries = defaultWebhookRetries
+	}
+	if hook.config.Backoff <= 0 {
+		hook.config.Backoff = defaultWebhookBackoff
+	}
+
+	hook.client.Timeout = hook.config.Timeout
+
+	return hook, nil
+}
+
+// compileWebhooks compiles the configured webhooks
+func compileWebhooks(configs []WebhookConfig) ([]*webhook, error) {
+	var hooks []*webhook
+
+	for index, cfg := range configs {
+		if hook, err := newWebhook(cfg); err != nil {
+			return nil, fmt.Errorf("webhook %v: %w", index, err)
+		} else {
+			hooks = append(hooks, hook)
+		}
+	}
+
+	return hooks, nil
+}
+
+// selected returns the subset of transitions which trigger this webhook
+func (w *webhook) selected(transitions []Transition) []Transition {
+	if len(w.config.On) == 0 {
+		return transitions
+	}
+
+	return slices.DeleteFunc(slices.Clone(transitions), func(t Transition) bool {
+		return !slices.Contains(w.config.On, t)
+	})
+}
+
+// render creates the request body for the given payload
+func (w *webhook) render(payload webhookPayload) ([]byte, error) {
+	var body bytes.Buffer
+
+	if w.body == nil {
+		err := json.NewEncoder(&body).Encode(payload)
+		return body.Bytes(), err
+	} else if err := w.body.Execute(&body, payload); err != nil {
+		return nil, err
+	}
+
+	return body.Bytes(), nil
+}
+
+// post sends a single request to the endpoint. If the request failed, retry
+// reports whether the request may succeed if sent again.
+func (w *webhook) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", w.config.ContentType)
+	req.Header.Set("User-Agent", "embermug")
+	for name, value := range w.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if w.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.config.Secret))
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("server responded with %v", resp.Status)
+	default:
+		return false, fmt.Errorf("server responded with %v", resp.Status)
+	}
+}
+
+// deliver sends the payload to the endpoint, retrying with exponential
+// backoff while the failure is temporary.
+func (w *webhook) deliver(ctx context.Context, logger *slog.Logger, payload webhookPayload) {
+	body, err := w.render(payload)
+	if err != nil {
+		logger.Error("Could not render webhook body", "Error", err)
+		return
+	}
+
+	for attempt, backoff := 0, w.config.Backoff; ; attempt, backoff = attempt+1, backoff*2 {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			logger.Debug("Delivered webhook", "Transitions", payload.Transitions, "Attempt", attempt+1)
+			return
+		} else if !retry || attempt >= w.config.Retries || ctx.Err() != nil {
+			logger.Error("Could not deliver webhook", "Transitions", payload.Transitions, "Attempt", attempt+1, "Error", err)
+			return
+		}
+
+		logger.Warn("Webhook delivery failed. Retrying.", "Attempt", attempt+1, "Backoff", backoff, "Error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// run delivers queued payloads in order until the context is cancelled
+func (w *webhook) run(ctx context.Context, logger *slog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-w.queue:
+			w.deliver(ctx, logger, payload)
+		}
+	}
+}
+
+// webhookClient posts to the configured webhooks whenever the mug state transitions
+func webhookClient(client *service.Client, hooks []*webhook, lowBattery int) {
+	var (
+		lastState service.State
+		logger    = slog.With("ClientID", client.ID)
+	)
+
+	for _, hook := range hooks {
+		go hook.run(client.Context, logger.With("URL", hook.config.URL))
+	}
+
+	logger.Info("Webhook Client Started", "Webhooks", len(hooks))
+
+	for {
+		select {
+		case <-client.Context.Done():
+			return
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			}
+
+			var (
+				transitions = detectTransitions(lastState, state, lowBattery)
+				changes     = state.Diff(lastState)
+				now         = time.Now()
+			)
+
+			for _, hook := range hooks {
+				selected := hook.selected(transitions)
+				if len(selected) == 0 {
+					continue
+				}
+
+				select {
+				case hook.queue <- webhookPayload{
+					Time:        now,
+					Transitions: selected,
+					State:       state,
+					Changes:     changes,
+				}:
+				default:
+					logger.Warn("Webhook queue is full. Dropping payload.", "URL", hook.config.URL)
+				}
+			}
+
+			lastState = state
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+// webhookRequest is a request received by a [webhookServer]
+type webhookRequest struct {
+	time   time.Time
+	header http.Header
+	body   []byte
+}
+
+// webhookServer records the requests it receives, and responds with the
+// given status codes in order (200 once they are exhausted).
+type webhookServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []webhookRequest
+	statuses []int
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	var server = &webhookServer{statuses: statuses}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Could not read request body: %v", err)
+		}
+
+		server.lock.Lock()
+		defer server.lock.Unlock()
+
+		var status = http.StatusOK
+		if len(server.requests) < len(server.statuses) {
+			status = server.statuses[len(server.requests)]
+		}
+
+		server.requests = append(server.requests, webhookRequest{time: time.Now(), header: r.Header.Clone(), body: body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *webhookServer) received() []webhookRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]webhookRequest(nil), s.requests...)
+}
+
+func testWebhookPayload() webhookPayload {
+	return webhookPayload{
+		Time:        time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC),
+		Transitions: []Transition{TransitionStable},
+		State: service.State{
+			Connected: true,
+			State:     embermug.StateStable,
+			HasLiquid: true,
+			Current:   embermug.Fahrenheit(135),
+			Target:    embermug.Fahrenheit(135),
+		},
+	}
+}
+
+func deliverWebhook(t *testing.T, cfg WebhookConfig) {
+	hook, err := newWebhook(cfg)
+	if err != nil {
+		t.Fatalf("newWebhook: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hook.deliver(ctx, slog.Default(), testWebhookPayload())
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "hunter2"
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "signed", secret: secret},
+		{name: "unsigned"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+			deliverWebhook(t, WebhookConfig{URL: server.URL, Secret: test.secret})
+
+			requests := server.received()
+			if len(requests) != 1 {
+				t.Fatalf("received %v requests, expected 1", len(requests))
+			}
+
+			signature := requests[0].header.Get(WebhookSignatureHeader)
+			if test.secret == "" {
+				if signature != "" {
+					t.Fatalf("unexpected signature %q without a secret", signature)
+				}
+				return
+			}
+
+			mac := hmac.New(sha256.New, []byte(test.secret))
+			mac.Write(requests[0].body)
+			if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != expected {
+				t.Fatalf("signature = %q, expected %q", signature, expected)
+			}
+		})
+	}
+}
+
+func TestWebhookBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         WebhookConfig
+		contentType string
+		body        string
+	}{
+		{
+			name:        "template",
+			cfg:         WebhookConfig{Body: `{{ .State.State }} at {{ toFahrenheit .State.Current }}F {{ json .Transitions }}`, ContentType: "text/plain"},
+			contentType: "text/plain",
+			body:        `stable at 135F ["stable"]`,
+		},
+		{
+			name:        "headers",
+			cfg:         WebhookConfig{Body: `{"text": {{ json .State.Preset }}}`, Headers: map[string]string{"Authorization": "Bearer token"}},
+			contentType: "application/json",
+			body:        `{"text": ""}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+			test.cfg.URL = server.URL
+			deliverWebhook(t, test.cfg)
+
+			requests := server.received()
+			if len(requests) != 1 {
+				t.Fatalf("received %v requests, expected 1", len(requests))
+			}
+
+			if contentType := requests[0].header.Get("Content-Type"); contentType != test.contentType {
+				t.Errorf("Content-Type = %q, expected %q", contentType, test.contentType)
+			}
+			if body := string(requests[0].body); body != test.body {
+				t.Errorf("body = %q, expected %q", body, test.body)
+			}
+			for name, value := range test.cfg.Headers {
+				if actual := requests[0].header.Get(name); actual != value {
+					t.Errorf("%v = %q, expected %q", name, actual, value)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookDefaultBody(t *testing.T) {
+	server := newWebhookServer(t)
+	deliverWebhook(t, WebhookConfig{URL: server.URL})
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %v requests, expected 1", len(requests))
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(requests[0].body, &payload); err != nil {
+		t.Fatalf("could not decode default body: %v", err)
+	}
+
+	expected := testWebhookPayload()
+	if !payload.Time.Equal(expected.Time) || payload.State.Target != expected.State.Target || len(payload.Transitions) != 1 || payload.Transitions[0] != TransitionStable {
+		t.Fatalf("payload = %+v, expected %+v", payload, expected)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		attempts int
+	}{
+		{name: "success", statuses: nil, retries: 3, attempts: 1},
+		{name: "recovers after 5xx", statuses: []int{500, 503}, retries: 3, attempts: 3},
+		{name: "retries 429", statuses: []int{429}, retries: 3, attempts: 2},
+		{name: "gives up after retries", statuses: []int{500, 500, 500, 500, 500}, retries: 2, attempts: 3},
+		{name: "retries disabled", statuses: []int{500}, retries: -1, attempts: 1},
+		{name: "no retry on 4xx", statuses: []int{400}, retries: 3, attempts: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newWebhookServer(t, test.statuses...)
+			deliverWebhook(t, WebhookConfig{URL: server.URL, Retries: test.retries, Backoff: backoff})
+
+			requests := server.received()
+			if len(requests) != test.attempts {
+				t.Fatalf("received %v requests, expected %v", len(requests), test.attempts)
+			}
+
+			// The delay before each retry doubles
+			for i := 1; i < len(requests); i++ {
+				expected := backoff << (i - 1)
+				if delay := requests[i].time.Sub(requests[i-1].time); delay < expected {
+					t.Errorf("retry %v after %v, expected at least %v", i, delay, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"embed"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/calebstewart/go-embermug/history"
+	"github.com/gorilla/websocket"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+const (
+	// websocketProtocol is the subprotocol selected for WebSocket clients
+	websocketProtocol = "embermug"
+
+	// websocketTokenProtocol prefixes the unpadded base64url encoded bearer
+	// token in a requested subprotocol. It is never selected, so the token
+	// is not echoed back to the client.
+	websocketTokenProtocol = "embermug.token."
+)
+
+// websocketUpgrader upgrades dashboard connections. The default origin check
+// rejects cross-origin connections, so other sites cannot control the mug
+// through a browser on the local network.
+var websocketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	Subprotocols:    []string{websocketProtocol},
+}
+
+// websocketConn adapts a WebSocket connection to the byte stream expected by
+// [service.Service.ServeClient]. Each write (one JSON update) is sent as a
+// single text message, and incoming messages are read back to back.
+type websocketConn struct {
+	conn   *websocket.Conn
+	reader io.Reader
+}
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			if _, reader, err := c.conn.NextReader(); err != nil {
+				// A close from the peer ends the stream like a closed socket
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					return 0, io.EOF
+				}
+				return 0, err
+			} else {
+				c.reader = reader
+			}
+		}
+
+		n, err := c.reader.Read(p)
+		if errors.Is(err, io.EOF) {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+
+		return n, err
+	}
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.conn.WriteMessage(websocket.TextMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *websocketConn) Close() error {
+	c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second),
+	)
+	return c.conn.Close()
+}
+
+// getWebSocket upgrades the request, and serves it as a service client
+func (a *httpAPI) getWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already responded with an error
+		slog.Debug("Could not upgrade WebSocket connection", "RemoteAddr", r.RemoteAddr, "Error", err)
+		return
+	}
+
+	slog.Debug("WebSocket client connected", "RemoteAddr", r.RemoteAddr)
+	a.svc.ServeClient(r.Context(), &websocketConn{conn: conn})
+}
+
+// getHistory responds with the recorded history between the 'since' and
+// 'until' query parameters, in the same format as the 'history' command. If
+// history recording is disabled, the response is an empty list.
+func (a *httpAPI) getHistory(w http.ResponseWriter, r *http.Request) {
+	var (
+		now   = time.Now()
+		query = r.URL.Query()
+	)
+
+	since, err := parseTimeArgument(query.Get("since"), now)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	until, err := parseTimeArgument(query.Get("until"), now)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeHistoryJSON(w, history.Query(historyDirectory(), since, until)); err != nil {
+		slog.Error("Could not read history", "Error", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+	}
+}
+
+// dashboardHandler serves the embedded web dashboard
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		// The dashboard directory is embedded at build time
+		panic(err)
+	}
+
+	return http.FileServerFS(files)
+}
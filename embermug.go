@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"iter"
+	"math"
 	"time"
 
 	"tinygo.org/x/bluetooth"
@@ -34,6 +35,7 @@ var (
 	ErrMalformedData             = errors.New("device returned malformed or unknown data")
 	ErrUnknownTemperatureUnit    = errors.New("unknown or invalid temperature unit")
 	ErrNameTooLong               = errors.New("mug name must be 14 bytes or fewer")
+	ErrInvalidDateTime           = errors.New("time cannot be represented by the mug clock")
 )
 
 // Color is  the color representation for the Ember Mug LED.
@@ -144,6 +146,74 @@ func (t Temperature) MarshalBinary() ([]byte, error) {
 	return result, nil
 }
 
+// DateTimeOffsetGranularity is the granularity of the timezone offset in a
+// [DateTime]. Every timezone currently in use is a multiple of 15 minutes
+// from UTC, including half-hour (e.g. India, Newfoundland) and 45 minute
+// (e.g. Nepal, Chatham Islands) zones.
+const DateTimeOffsetGranularity = 15 * time.Minute
+
+// DateTime is the value of the mug clock characteristic. It is encoded as
+// five bytes: a little-endian, unsigned 32-bit unix timestamp followed by a
+// signed 8-bit timezone offset from UTC in units of [DateTimeOffsetGranularity].
+// This allows offsets from -32h to +31h45m, and round-trips exactly for any
+// time with second precision between 1970 and 2106.
+type DateTime struct {
+	Timestamp time.Time     // Instant in time (truncated to second precision)
+	Offset    time.Duration // Timezone offset from UTC (east is positive)
+}
+
+// NewDateTime returns the [DateTime] for the given time and the offset of
+// the time's location at that instant. Offsets which are not a multiple of
+// [DateTimeOffsetGranularity] are rejected when marshaling.
+func NewDateTime(t time.Time) DateTime {
+	_, offset := t.Zone()
+	return DateTime{
+		Timestamp: t,
+		Offset:    time.Duration(offset) * time.Second,
+	}
+}
+
+// Time returns the timestamp in a fixed zone with the stored offset.
+func (d DateTime) Time() time.Time {
+	return d.Timestamp.In(time.FixedZone("", int(d.Offset/time.Second)))
+}
+
+func (d *DateTime) Read(ch *bluetooth.DeviceCharacteristic) error {
+	var data = make([]byte, 5)
+	if n, err := ch.Read(data); err != nil {
+		return err
+	} else {
+		return d.UnmarshalBinary(data[:n])
+	}
+}
+
+func (d *DateTime) UnmarshalBinary(data []byte) error {
+	if len(data) != 5 {
+		return fmt.Errorf("%w: date time: %v (expected 5 bytes)", ErrMalformedData, data)
+	}
+
+	d.Timestamp = time.Unix(int64(binary.LittleEndian.Uint32(data[0:4])), 0)
+	d.Offset = time.Duration(int8(data[4])) * DateTimeOffsetGranularity
+	return nil
+}
+
+func (d DateTime) MarshalBinary() ([]byte, error) {
+	var (
+		timestamp = d.Timestamp.Unix()
+		offset    = d.Offset / DateTimeOffsetGranularity
+	)
+
+	if timestamp < 0 || timestamp > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: timestamp out of range: %v", ErrInvalidDateTime, d.Timestamp)
+	} else if d.Offset%DateTimeOffsetGranularity != 0 {
+		return nil, fmt.Errorf("%w: offset is not a multiple of %v: %v", ErrInvalidDateTime, DateTimeOffsetGranularity, d.Offset)
+	} else if offset < math.MinInt8 || offset > math.MaxInt8 {
+		return nil, fmt.Errorf("%w: offset out of range: %v", ErrInvalidDateTime, d.Offset)
+	}
+
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(timestamp)), byte(int8(offset))), nil
+}
+
 // BatteryState holds the  decoded battery information
 type BatteryState struct {
 	Charge      int         // Percent charged (0-100)
@@ -548,22 +618,35 @@ func (m *Mug) SetName(name string) error {
 	return err
 }
 
+// SetTime sets the mug clock to the given time, including the timezone
+// offset of its location. See [DateTime] for encoding details.
 func (m *Mug) SetTime(t time.Time) error {
-	var (
-		timestamp      = uint32(t.Unix())
-		_, tzOffsetSec = t.Zone()
-		data           = append(
-			binary.LittleEndian.AppendUint32([]byte{}, timestamp),
-			uint8((time.Second*time.Duration(tzOffsetSec))/time.Hour),
-		)
-	)
-
 	if m.dateTime == nil {
 		return ErrUnsupportedCharacteristic
 	}
 
-	_, err := m.dateTime.WriteWithoutResponse(data)
-	return err
+	if data, err := NewDateTime(t).MarshalBinary(); err != nil {
+		return err
+	} else if _, err := m.dateTime.WriteWithoutResponse(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetTime reads the current time and timezone offset from the mug clock.
+// The returned time is in a fixed zone matching the offset stored on the mug.
+func (m *Mug) GetTime() (t time.Time, err error) {
+	if m.dateTime == nil {
+		return t, ErrUnsupportedCharacteristic
+	}
+
+	var d DateTime
+	if err := d.Read(m.dateTime); err != nil {
+		return t, err
+	}
+
+	return d.Time(), nil
 }
 
 func (m *Mug) StartEventNotifications(handler func(Event)) error {
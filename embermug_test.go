@@ -0,0 +1,97 @@
+package embermug
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDateTimeRoundTrip(t *testing.T) {
+	var instant = time.Date(2024, time.March, 10, 12, 30, 45, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		offset time.Duration // Offset of the zone the time is in
+		wire   byte          // Expected encoded offset in quarter hours
+	}{
+		{name: "UTC", offset: 0, wire: 0},
+		{name: "UTC+2", offset: 2 * time.Hour, wire: 0x08},
+		{name: "UTC-5", offset: -5 * time.Hour, wire: 0xec},
+		{name: "UTC+14", offset: 14 * time.Hour, wire: 0x38},
+		{name: "UTC-12", offset: -12 * time.Hour, wire: 0xd0},
+		{name: "UTC+5:30", offset: 5*time.Hour + 30*time.Minute, wire: 0x16},
+		{name: "UTC-3:30", offset: -3*time.Hour - 30*time.Minute, wire: 0xf2},
+		{name: "UTC+5:45", offset: 5*time.Hour + 45*time.Minute, wire: 0x17},
+		{name: "UTC+12:45", offset: 12*time.Hour + 45*time.Minute, wire: 0x33},
+		{name: "UTC+31:45", offset: 31*time.Hour + 45*time.Minute, wire: 0x7f},
+		{name: "UTC-32", offset: -32 * time.Hour, wire: 0x80},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				zone  = time.FixedZone(test.name, int(test.offset/time.Second))
+				input = NewDateTime(instant.In(zone))
+			)
+
+			data, err := input.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+
+			var expected = []byte{0xf5, 0xa7, 0xed, 0x65, test.wire}
+			if !bytes.Equal(data, expected) {
+				t.Fatalf("MarshalBinary = % x, expected % x", data, expected)
+			}
+
+			var output DateTime
+			if err := output.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary: %v", err)
+			}
+
+			if !output.Timestamp.Equal(instant) {
+				t.Errorf("Timestamp = %v, expected %v", output.Timestamp, instant)
+			}
+			if output.Offset != test.offset {
+				t.Errorf("Offset = %v, expected %v", output.Offset, test.offset)
+			}
+			if _, offset := output.Time().Zone(); time.Duration(offset)*time.Second != test.offset {
+				t.Errorf("Time zone offset = %vs, expected %v", offset, test.offset)
+			}
+		})
+	}
+}
+
+func TestDateTimeMarshalErrors(t *testing.T) {
+	var instant = time.Date(2024, time.March, 10, 12, 30, 45, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value DateTime
+	}{
+		{name: "20 minute offset", value: DateTime{Timestamp: instant, Offset: 5*time.Hour + 20*time.Minute}},
+		{name: "offset in seconds", value: DateTime{Timestamp: instant, Offset: 5*time.Hour + 30*time.Minute + time.Second}},
+		{name: "offset too large", value: DateTime{Timestamp: instant, Offset: 32 * time.Hour}},
+		{name: "offset too small", value: DateTime{Timestamp: instant, Offset: -32*time.Hour - 15*time.Minute}},
+		{name: "before 1970", value: DateTime{Timestamp: time.Date(1969, time.December, 31, 0, 0, 0, 0, time.UTC)}},
+		{name: "after 2106", value: DateTime{Timestamp: time.Date(2107, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if data, err := test.value.MarshalBinary(); !errors.Is(err, ErrInvalidDateTime) {
+				t.Fatalf("MarshalBinary = % x, %v, expected %v", data, err, ErrInvalidDateTime)
+			}
+		})
+	}
+}
+
+func TestDateTimeUnmarshalMalformed(t *testing.T) {
+	for _, data := range [][]byte{nil, {0x01, 0x02, 0x03, 0x04}, {0x01, 0x02, 0x03, 0x04, 0x05, 0x06}} {
+		var d DateTime
+		if err := d.UnmarshalBinary(data); !errors.Is(err, ErrMalformedData) {
+			t.Errorf("UnmarshalBinary(% x) = %v, expected %v", data, err, ErrMalformedData)
+		}
+	}
+}
@@ -16,7 +16,7 @@
       version = "0.0.1";
       src = ./.;
       subPackages = ["./cli"];
-      vendorHash = "sha256-RLE7ooj6RfFWKwHu08DGfXhfbVkR75FcHNq3z78oW8c=";
+      vendorHash = "sha256-WNlk5pNuWqNLR0Oj6qKtEKwOzuFf5M1YQy8cdRhu31w=";
       postInstall = "mv $out/bin/cli $out/bin/embermug";
 
       meta = {
@@ -0,0 +1,281 @@
+// Package history implements an append-only store of mug telemetry. Each
+// [Record] is written as a single line of JSON to the active history file.
+// When the active file grows beyond the configured size, it is rotated to a
+// timestamped file, and rotated files older than the retention period are
+// removed.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calebstewart/go-embermug/service"
+)
+
+const (
+	activeName     = "history.ndjson"            // Name of the file currently being appended to
+	rotatedPrefix  = "history-"                  // Prefix of rotated history files
+	rotatedSuffix  = ".ndjson"                   // Suffix of rotated history files
+	rotatedTimeFmt = "20060102T150405.000000000" // Time format used in rotated file names
+	DefaultMaxSize = 10 * 1024 * 1024            // Default maximum size of the active file in bytes
+)
+
+var (
+	ErrClosed = errors.New("history store is closed")
+)
+
+// Record is a single timestamped snapshot of the mug state.
+type Record struct {
+	Time  time.Time     // Time the state was observed
+	State service.State // The observed state
+}
+
+// Options controls rotation and retention of the history files.
+type Options struct {
+	MaxSize   int64         // Rotate the active file once it exceeds this many bytes (0 uses DefaultMaxSize)
+	Retention time.Duration // Remove rotated files older than this (0 keeps them forever)
+}
+
+// Store appends records to the history files in a directory.
+type Store struct {
+	lock    sync.Mutex
+	dir     string
+	options Options
+	file    *os.File
+	size    int64
+}
+
+// Open opens (or creates) a history store in the given directory.
+func Open(dir string, options Options) (*Store, error) {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultMaxSize
+	}
+
+	s := &Store{
+		dir:     dir,
+		options: options,
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	} else if err := s.open(); err != nil {
+		return nil, err
+	} else if err := s.prune(time.Now()); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open opens the active history file for appending
+func (s *Store) open() error {
+	if file, err := os.OpenFile(filepath.Join(s.dir, activeName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+		return err
+	} else if info, err := file.Stat(); err != nil {
+		file.Close()
+		return err
+	} else {
+		s.file = file
+		s.size = info.Size()
+		return nil
+	}
+}
+
+// Append writes the given record to the active history file, and rotates
+// the file if it has grown beyond the maximum size.
+func (s *Store) Append(record Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return ErrClosed
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.file.Write(append(data, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if s.size >= s.options.MaxSize {
+		return s.rotate(record.Time)
+	}
+
+	return nil
+}
+
+// rotate renames the active file to a timestamped name, opens a new active
+// file, and removes rotated files outside of the retention period.
+func (s *Store) rotate(now time.Time) error {
+	var rotated = filepath.Join(s.dir, rotatedPrefix+now.UTC().Format(rotatedTimeFmt)+rotatedSuffix)
+
+	if err := s.file.Close(); err != nil {
+		return err
+	} else if err := os.Rename(filepath.Join(s.dir, activeName), rotated); err != nil {
+		return err
+	} else if err := s.open(); err != nil {
+		s.file = nil
+		return err
+	} else {
+		return s.prune(now)
+	}
+}
+
+// prune removes rotated files which were rotated before the retention period.
+func (s *Store) prune(now time.Time) error {
+	if s.options.Retention <= 0 {
+		return nil
+	}
+
+	files, err := rotatedFiles(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, file := range files {
+		if now.Sub(file.rotated) > s.options.Retention {
+			if err := os.Remove(file.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes the active history file.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return ErrClosed
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+type rotatedFile struct {
+	path    string
+	rotated time.Time
+}
+
+// rotatedFiles returns the rotated history files in the directory, ordered
+// from oldest to newest.
+func rotatedFiles(dir string) ([]rotatedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, rotatedPrefix) || !strings.HasSuffix(name, rotatedSuffix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, rotatedPrefix), rotatedSuffix)
+		if rotated, err := time.Parse(rotatedTimeFmt, stamp); err == nil {
+			files = append(files, rotatedFile{
+				path:    filepath.Join(dir, name),
+				rotated: rotated,
+			})
+		}
+	}
+
+	slices.SortFunc(files, func(a, b rotatedFile) int {
+		return a.rotated.Compare(b.rotated)
+	})
+
+	return files, nil
+}
+
+// Query returns an iterator over all records in the given history directory
+// observed within [from, until). A zero time leaves that end of the range
+// open. Records are yielded from oldest to newest. Malformed records are
+// skipped, so errors are only yielded for I/O failures.
+func Query(dir string, from, until time.Time) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		files, err := rotatedFiles(dir)
+		if err != nil {
+			yield(Record{}, err)
+			return
+		}
+
+		var paths []string
+		for _, file := range files {
+			// Rotated files only contain records from before they were rotated
+			if from.IsZero() || !file.rotated.Before(from) {
+				paths = append(paths, file.path)
+			}
+		}
+		paths = append(paths, filepath.Join(dir, activeName))
+
+		for _, path := range paths {
+			if !queryFile(path, from, until, yield) {
+				return
+			}
+		}
+	}
+}
+
+// queryFile yields the records in a single history file within the given
+// range. It returns false if the caller stopped iteration.
+func queryFile(path string, from, until time.Time, yield func(Record, error) bool) bool {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	} else if err != nil {
+		return yield(Record{}, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+
+		// A crash may leave a truncated record, which should not prevent
+		// reading the rest of the history.
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			slog.Warn("Skipping malformed history record", "Path", path, "Line", line, "Error", err)
+			continue
+		}
+
+		if !from.IsZero() && record.Time.Before(from) {
+			continue
+		} else if !until.IsZero() && !record.Time.Before(until) {
+			continue
+		} else if !yield(record, nil) {
+			return false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return yield(Record{}, fmt.Errorf("%v: %w", path, err))
+	}
+
+	return true
+}
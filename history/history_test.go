@@ -0,0 +1,240 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"github.com/calebstewart/go-embermug/service"
+)
+
+var testStart = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+// testRecord returns a record observed the given number of minutes after
+// the start of the test.
+func testRecord(minutes int) Record {
+	return Record{
+		Time: testStart.Add(time.Duration(minutes) * time.Minute),
+		State: service.State{
+			Connected: true,
+			State:     embermug.StateStable,
+			Current:   embermug.Celsius(50 + float64(minutes)),
+		},
+	}
+}
+
+// queryMinutes collects the records within the given range, as minutes
+// after the start of the test.
+func queryMinutes(t *testing.T, dir string, from, until time.Time) []int {
+	t.Helper()
+
+	var minutes []int
+	for record, err := range Query(dir, from, until) {
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		minutes = append(minutes, int(record.Time.Sub(testStart)/time.Minute))
+	}
+	return minutes
+}
+
+func TestStoreRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	// Each record is larger than the maximum size, so every append rotates
+	store, err := Open(dir, Options{MaxSize: 1})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for minutes := range 3 {
+		if err := store.Append(testRecord(minutes)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	files, err := rotatedFiles(dir)
+	if err != nil {
+		t.Fatalf("rotatedFiles: %v", err)
+	} else if len(files) != 3 {
+		t.Fatalf("%v rotated files, expected 3", len(files))
+	}
+	for index, file := range files {
+		if expected := testRecord(index).Time; !file.rotated.Equal(expected) {
+			t.Errorf("file %v rotated at %v, expected %v", index, file.rotated, expected)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, activeName)); err != nil {
+		t.Fatalf("active file: %v", err)
+	} else if info.Size() != 0 {
+		t.Errorf("active file has %v bytes after rotating", info.Size())
+	}
+
+	if minutes := queryMinutes(t, dir, time.Time{}, time.Time{}); !slices.Equal(minutes, []int{0, 1, 2}) {
+		t.Errorf("records = %v, expected [0 1 2]", minutes)
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	for minutes := range 2 {
+		store, err := Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		} else if err := store.Append(testRecord(minutes)); err != nil {
+			t.Fatalf("Append: %v", err)
+		} else if err := store.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		if err := store.Append(testRecord(minutes)); !errors.Is(err, ErrClosed) {
+			t.Fatalf("Append after Close = %v, expected %v", err, ErrClosed)
+		}
+	}
+
+	// Reopening appends to the active file
+	if minutes := queryMinutes(t, dir, time.Time{}, time.Time{}); !slices.Equal(minutes, []int{0, 1}) {
+		t.Errorf("records = %v, expected [0 1]", minutes)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir, Options{MaxSize: 1, Retention: 90 * time.Minute})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer store.Close()
+
+	// Rotating the last record prunes files rotated more than 90 minutes before it
+	for _, minutes := range []int{0, 60, 120, 180} {
+		if err := store.Append(testRecord(minutes)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	if minutes := queryMinutes(t, dir, time.Time{}, time.Time{}); !slices.Equal(minutes, []int{120, 180}) {
+		t.Errorf("records = %v, expected [120 180]", minutes)
+	}
+
+	// Files left from before are pruned when the store is opened
+	store.Close()
+	if store, err := Open(dir, Options{Retention: time.Hour}); err != nil {
+		t.Fatalf("Open: %v", err)
+	} else {
+		store.Close()
+	}
+
+	if files, err := rotatedFiles(dir); err != nil {
+		t.Fatalf("rotatedFiles: %v", err)
+	} else if len(files) != 0 {
+		t.Errorf("%v rotated files remain, expected none", len(files))
+	}
+}
+
+func TestQuerySkipsMalformed(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Append(testRecord(0)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// A truncated record, as left by a crash, followed by garbage
+	if _, err := store.file.WriteString(`{"Time":"2024-03-10T12:01:00Z","State":{"Conn` + "\nnot json\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Append(testRecord(2)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	if minutes := queryMinutes(t, dir, time.Time{}, time.Time{}); !slices.Equal(minutes, []int{0, 2}) {
+		t.Errorf("records = %v, expected [0 2]", minutes)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	dir := t.TempDir()
+
+	// Rotate after every two records
+	data, err := json.Marshal(testRecord(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(dir, Options{MaxSize: 2 * int64(len(data)+1)})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer store.Close()
+
+	for minutes := range 7 {
+		if err := store.Append(testRecord(minutes)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	if files, err := rotatedFiles(dir); err != nil {
+		t.Fatalf("rotatedFiles: %v", err)
+	} else if len(files) != 3 {
+		t.Fatalf("%v rotated files, expected 3", len(files))
+	}
+
+	minute := func(minutes int) time.Time { return testRecord(minutes).Time }
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		until    time.Time
+		expected []int
+	}{
+		{name: "all", expected: []int{0, 1, 2, 3, 4, 5, 6}},
+		{name: "from", from: minute(3), expected: []int{3, 4, 5, 6}},
+		{name: "until", until: minute(3), expected: []int{0, 1, 2}},
+		{name: "between", from: minute(2), until: minute(5), expected: []int{2, 3, 4}},
+		{name: "between files", from: minute(1), until: minute(2), expected: []int{1}},
+		{name: "empty", from: minute(4), until: minute(4)},
+		{name: "after", from: minute(10)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if minutes := queryMinutes(t, dir, test.from, test.until); !slices.Equal(minutes, test.expected) {
+				t.Errorf("records = %v, expected %v", minutes, test.expected)
+			}
+		})
+	}
+
+	t.Run("stop", func(t *testing.T) {
+		var count int
+		for range Query(dir, time.Time{}, time.Time{}) {
+			if count++; count == 3 {
+				break
+			}
+		}
+		if count != 3 {
+			t.Errorf("iterated %v records, expected 3", count)
+		}
+	})
+}
+
+func TestQueryMissingDirectory(t *testing.T) {
+	if minutes := queryMinutes(t, filepath.Join(t.TempDir(), "missing"), time.Time{}, time.Time{}); len(minutes) != 0 {
+		t.Errorf("records = %v, expected none", minutes)
+	}
+}
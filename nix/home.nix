@@ -19,12 +19,8 @@ in {
     settings = lib.mkOption {
       description = "Free-form settings written to embermug configuration file in TOML format";
       type = lib.types.attrs;
-      default = {
-        socket-path = "/tmp/embermug.sock";
-      };
+      default = {};
       example = {
-        socket-path = "/tmp/embermug.sock";
-
         service = {
           device-address = "AA:BB:CC:DD:EE:FF";
           enable-notifications = true;
@@ -107,7 +103,8 @@ in {
         };
 
         # Initialize the listen stream either from the settings or with the default path
-        Socket.ListenStream = lib.attrByPath ["socket-path"] "/tmp/embermug.sock" cfg.settings;
+        # ($XDG_RUNTIME_DIR/embermug.sock, which is private to the user)
+        Socket.ListenStream = lib.attrByPath ["socket-path"] "%t/embermug.sock" cfg.settings;
 
         Install = {
           WantedBy = [cfg.systemd.target];
@@ -122,7 +119,9 @@ in {
         };
 
         Service = {
-          Type = "simple";
+          Type = "notify";
+          WatchdogSec = 60;
+          Restart = "on-watchdog";
           ExecStart = lib.escapeShellArgs [
             (lib.getExe cfg.package)
             "service"
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrUnknownRole      = errors.New("unknown role: expected 'read-only' or 'control'")
+)
+
+// Role is the level of access granted to a socket client
+type Role int
+
+const (
+	RoleDenied   Role = iota // The connection is closed immediately
+	RoleReadOnly             // The client receives state updates, but messages are rejected
+	RoleControl              // The client may send messages to control the mug
+)
+
+// ParseRole parses the configuration name of a role
+func ParseRole(name string) (Role, error) {
+	switch name {
+	case "read-only":
+		return RoleReadOnly, nil
+	case "control":
+		return RoleControl, nil
+	default:
+		return RoleDenied, fmt.Errorf("%w: %q", ErrUnknownRole, name)
+	}
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleDenied:
+		return "denied"
+	case RoleReadOnly:
+		return "read-only"
+	case RoleControl:
+		return "control"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+// PeerCredentials identifies the process on the other end of a unix socket
+type PeerCredentials struct {
+	PID    int32
+	UID    uint32
+	GID    uint32   // Primary group
+	Groups []uint32 // Supplementary groups (empty if they could not be read)
+}
+
+// AccessRule grants a role to socket clients running as one of the given
+// users, or as a member of one of the given groups.
+type AccessRule struct {
+	UIDs []uint32
+	GIDs []uint32
+	Role Role
+}
+
+// matches returns whether the rule applies to the peer
+func (r AccessRule) matches(cred PeerCredentials) bool {
+	if slices.Contains(r.UIDs, cred.UID) || slices.Contains(r.GIDs, cred.GID) {
+		return true
+	}
+
+	for _, gid := range cred.Groups {
+		if slices.Contains(r.GIDs, gid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorize returns the role of a newly accepted socket client. Without
+// access rules, every client may control the mug. Otherwise, the client
+// receives the highest role of all matching rules, and clients which match
+// no rule (or whose credentials cannot be read) are denied. The rules only
+// apply to unix socket clients, since other clients have no peer credentials
+// and are authenticated by the listener handshake instead.
+func (s *Service) authorize(conn net.Conn, logger *slog.Logger) Role {
+	if _, ok := conn.(*net.UnixConn); len(s.access) == 0 || !ok {
+		return RoleControl
+	}
+
+	cred, err := ReadPeerCredentials(conn)
+	if err != nil {
+		logger.Warn("Rejected client without credentials", "Error", err)
+		return RoleDenied
+	}
+
+	var role = RoleDenied
+	for _, rule := range s.access {
+		if rule.matches(cred) {
+			role = max(role, rule.Role)
+		}
+	}
+
+	logger = logger.With("PID", cred.PID, "UID", cred.UID, "GID", cred.GID)
+	if role == RoleDenied {
+		logger.Warn("Rejected unauthorized client")
+	} else {
+		logger.Debug("Authorized client", "Role", role)
+	}
+
+	return role
+}
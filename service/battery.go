@@ -0,0 +1,168 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	batteryRateWeight = 0.3 // Weight of a new measurement in the moving average rate
+	batteryModeCharge = "charging"
+)
+
+// batteryRate is the learned rate of change in battery charge for a single mode.
+type batteryRate struct {
+	Rate    float64 // Average rate of change in percent per hour
+	Samples int     // Number of measurements averaged into Rate
+}
+
+// batteryEstimator learns how quickly the battery charges and discharges
+// while the mug is in each state, and uses those rates to estimate the
+// time until the battery is empty or fully charged. Discharge rates are
+// tracked separately per mug state (e.g. heating vs. stable vs. empty)
+// since the heater dominates power usage. The learned rates are persisted
+// so estimates improve across restarts.
+type batteryEstimator struct {
+	path  string                  // Path to persist learned rates (empty to disable)
+	rates map[string]*batteryRate // Learned rates by mode
+
+	mode         string    // Mode of the current measurement
+	lastCharge   int       // Last observed charge in the current mode
+	anchored     bool      // Whether anchorTime and anchorCharge are valid
+	anchorTime   time.Time // Time at which the charge last changed
+	anchorCharge int       // Charge at anchorTime
+}
+
+// Load reads previously learned rates from the given path. A missing file
+// is not an error. Entries without a rate (such as 'null' in a corrupted
+// file) are dropped. The path is also used to persist future updates.
+func (e *batteryEstimator) Load(path string) error {
+	e.path = path
+	e.rates = make(map[string]*batteryRate)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var rates map[string]*batteryRate
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return err
+	}
+
+	for mode, rate := range rates {
+		if rate != nil {
+			e.rates[mode] = rate
+		}
+	}
+
+	return nil
+}
+
+// save writes the learned rates to the configured path.
+func (e *batteryEstimator) save() error {
+	if e.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(e.rates, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := e.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o755); err != nil {
+		return err
+	} else if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	} else {
+		return os.Rename(tmp, e.path)
+	}
+}
+
+// Observe records the battery charge from the given state, and returns the
+// estimated time until the battery is empty (while discharging) and until
+// it is full (while charging). A zero duration means no estimate is available.
+func (e *batteryEstimator) Observe(now time.Time, state State) (toEmpty time.Duration, toFull time.Duration) {
+	var (
+		charge = state.Battery.Charge
+		mode   = state.State.String()
+	)
+
+	if e.rates == nil {
+		e.rates = make(map[string]*batteryRate)
+	}
+
+	if state.Battery.Charging {
+		mode = batteryModeCharge
+	}
+
+	if !state.Connected {
+		e.mode = ""
+		e.anchored = false
+		return 0, 0
+	} else if mode != e.mode {
+		// Partial percentage steps are meaningless, so wait for the
+		// charge to change before measuring in a new mode.
+		e.mode = mode
+		e.anchored = false
+		e.lastCharge = charge
+	} else if charge != e.lastCharge {
+		e.measure(now, charge)
+		e.lastCharge = charge
+	}
+
+	if rate, ok := e.rates[mode]; !ok || rate.Rate <= 0 {
+		return 0, 0
+	} else if mode == batteryModeCharge {
+		return 0, hoursToDuration(float64(100-charge) / rate.Rate)
+	} else {
+		return hoursToDuration(float64(charge) / rate.Rate), 0
+	}
+}
+
+// measure updates the learned rate for the current mode after the charge
+// changed to the given value.
+func (e *batteryEstimator) measure(now time.Time, charge int) {
+	var delta = e.anchorCharge - charge
+	if e.mode == batteryModeCharge {
+		delta = -delta
+	}
+
+	if e.anchored && delta > 0 {
+		var (
+			hours = now.Sub(e.anchorTime).Hours()
+			rate  = float64(delta) / hours
+			learn = e.rates[e.mode]
+		)
+
+		if learn == nil {
+			learn = &batteryRate{Rate: rate}
+			e.rates[e.mode] = learn
+		} else {
+			learn.Rate = (1-batteryRateWeight)*learn.Rate + batteryRateWeight*rate
+		}
+		learn.Samples += 1
+
+		slog.Debug("Updated battery rate estimate", "Mode", e.mode, "RatePerHour", learn.Rate, "Samples", learn.Samples)
+
+		if err := e.save(); err != nil {
+			slog.Warn("Could not persist battery estimates", "Path", e.path, "Error", err)
+		}
+	}
+
+	e.anchored = true
+	e.anchorTime = now
+	e.anchorCharge = charge
+}
+
+func hoursToDuration(hours float64) time.Duration {
+	return time.Duration(hours * float64(time.Hour))
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+func TestBatteryEstimatorLoad(t *testing.T) {
+	stable := embermug.StateStable.String()
+
+	tests := []struct {
+		name     string
+		data     string // File contents (empty for a missing file)
+		expected map[string]batteryRate
+		invalid  bool
+	}{
+		{name: "missing", expected: map[string]batteryRate{}},
+		{
+			name:     "rates",
+			data:     `{"charging": {"Rate": 40, "Samples": 3}, "stable": {"Rate": 5.5, "Samples": 10}}`,
+			expected: map[string]batteryRate{batteryModeCharge: {Rate: 40, Samples: 3}, stable: {Rate: 5.5, Samples: 10}},
+		},
+		{
+			name:     "null entry",
+			data:     `{"charging": null, "stable": {"Rate": 5.5, "Samples": 10}}`,
+			expected: map[string]batteryRate{stable: {Rate: 5.5, Samples: 10}},
+		},
+		{name: "malformed", data: `{"charging": {"Rate": 4`, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				path      = filepath.Join(t.TempDir(), "battery.json")
+				estimator batteryEstimator
+			)
+
+			if test.data != "" {
+				if err := os.WriteFile(path, []byte(test.data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := estimator.Load(path)
+			if test.invalid {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else if err != nil {
+				t.Fatalf("Load: %v", err)
+			} else if len(estimator.rates) != len(test.expected) {
+				t.Fatalf("rates = %v, expected %v", estimator.rates, test.expected)
+			}
+
+			for mode, expected := range test.expected {
+				if rate := estimator.rates[mode]; rate == nil || *rate != expected {
+					t.Errorf("%v = %v, expected %v", mode, rate, expected)
+				}
+			}
+
+			// Every mode can be observed after loading, even after an error
+			for _, mode := range []embermug.State{embermug.StateStable, embermug.StateHeating} {
+				estimator.Observe(time.Now(), State{Connected: true, State: mode, Battery: embermug.BatteryState{Charge: 50}})
+			}
+			estimator.Observe(time.Now(), State{Connected: true, Battery: embermug.BatteryState{Charge: 50, Charging: true}})
+		})
+	}
+}
+
+// batteryObservation is a single observed battery charge, at an offset from
+// the start of the test.
+type batteryObservation struct {
+	offset   time.Duration
+	charge   int
+	charging bool
+	state    embermug.State
+}
+
+func observeBattery(estimator *batteryEstimator, start time.Time, observations []batteryObservation) (toEmpty, toFull time.Duration) {
+	for _, o := range observations {
+		state := o.state
+		if state == 0 {
+			state = embermug.StateStable
+		}
+
+		toEmpty, toFull = estimator.Observe(start.Add(o.offset), State{
+			Connected: true,
+			State:     state,
+			Battery:   embermug.BatteryState{Charge: o.charge, Charging: o.charging},
+		})
+	}
+	return toEmpty, toFull
+}
+
+func TestBatteryEstimatorObserve(t *testing.T) {
+	var start = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		observations []batteryObservation
+		toEmpty      time.Duration
+		toFull       time.Duration
+		rate         float64 // Expected learned rate of the last mode (zero for none)
+	}{
+		{
+			name: "no change",
+			observations: []batteryObservation{
+				{offset: 0, charge: 80},
+				{offset: time.Hour, charge: 80},
+			},
+		},
+		{
+			// The first change only anchors the measurement, since the
+			// charge may have been part way through a percent.
+			name: "first change",
+			observations: []batteryObservation{
+				{offset: 0, charge: 80},
+				{offset: 10 * time.Minute, charge: 79},
+			},
+		},
+		{
+			name: "discharging",
+			observations: []batteryObservation{
+				{offset: 0, charge: 80},
+				{offset: 10 * time.Minute, charge: 79},
+				{offset: 40 * time.Minute, charge: 78},
+			},
+			toEmpty: 39 * time.Hour,
+			rate:    2,
+		},
+		{
+			// The new rate (4%/h) is averaged with the previous rate (2%/h)
+			name: "moving average",
+			observations: []batteryObservation{
+				{offset: 0, charge: 80},
+				{offset: 10 * time.Minute, charge: 79},
+				{offset: 40 * time.Minute, charge: 78},
+				{offset: 55 * time.Minute, charge: 77},
+			},
+			toEmpty: hoursToDuration(77 / 2.6),
+			rate:    0.7*2 + 0.3*4,
+		},
+		{
+			name: "charging",
+			observations: []batteryObservation{
+				{offset: 0, charge: 40, charging: true},
+				{offset: time.Minute, charge: 41, charging: true},
+				{offset: 3 * time.Minute, charge: 42, charging: true},
+			},
+			toFull: hoursToDuration(58.0 / 30),
+			rate:   30,
+		},
+		{
+			// Each mug state learns its own discharge rate
+			name: "state change",
+			observations: []batteryObservation{
+				{offset: 0, charge: 80},
+				{offset: 10 * time.Minute, charge: 79},
+				{offset: 40 * time.Minute, charge: 78},
+				{offset: 41 * time.Minute, charge: 78, state: embermug.StateHeating},
+				{offset: 50 * time.Minute, charge: 77, state: embermug.StateHeating},
+			},
+		},
+		{
+			// The charge rising while discharging is not a measurement
+			name: "charge increases",
+			observations: []batteryObservation{
+				{offset: 0, charge: 80},
+				{offset: 10 * time.Minute, charge: 79},
+				{offset: 40 * time.Minute, charge: 80},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var estimator batteryEstimator
+
+			toEmpty, toFull := observeBattery(&estimator, start, test.observations)
+			if !durationNear(toEmpty, test.toEmpty) || !durationNear(toFull, test.toFull) {
+				t.Errorf("estimates = %v, %v, expected %v, %v", toEmpty, toFull, test.toEmpty, test.toFull)
+			}
+
+			var rate float64
+			if learned := estimator.rates[estimator.mode]; learned != nil {
+				rate = learned.Rate
+			}
+			if math.Abs(rate-test.rate) > 1e-9 {
+				t.Errorf("rate = %v, expected %v", rate, test.rate)
+			}
+		})
+	}
+}
+
+func TestBatteryEstimatorDisconnect(t *testing.T) {
+	var (
+		estimator batteryEstimator
+		start     = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	)
+
+	observeBattery(&estimator, start, []batteryObservation{
+		{offset: 0, charge: 80},
+		{offset: 10 * time.Minute, charge: 79},
+		{offset: 40 * time.Minute, charge: 78},
+	})
+
+	if toEmpty, toFull := estimator.Observe(start.Add(time.Hour), State{}); toEmpty != 0 || toFull != 0 {
+		t.Fatalf("estimates = %v, %v while disconnected", toEmpty, toFull)
+	}
+
+	// The charge lost while disconnected is not measured, but the learned
+	// rate is still used.
+	toEmpty, _ := observeBattery(&estimator, start, []batteryObservation{
+		{offset: 5 * time.Hour, charge: 50},
+		{offset: 5*time.Hour + time.Minute, charge: 49},
+	})
+	if estimator.rates[embermug.StateStable.String()].Rate != 2 {
+		t.Errorf("rate = %v, expected 2", estimator.rates[embermug.StateStable.String()].Rate)
+	}
+	if !durationNear(toEmpty, 49*time.Hour/2) {
+		t.Errorf("toEmpty = %v, expected %v", toEmpty, 49*time.Hour/2)
+	}
+}
+
+func TestBatteryEstimatorPersists(t *testing.T) {
+	var (
+		path      = filepath.Join(t.TempDir(), "state", "battery.json")
+		start     = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+		estimator batteryEstimator
+	)
+
+	if err := estimator.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	observeBattery(&estimator, start, []batteryObservation{
+		{offset: 0, charge: 80},
+		{offset: 10 * time.Minute, charge: 79},
+		{offset: 40 * time.Minute, charge: 78},
+	})
+
+	var restored batteryEstimator
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// The learned rate is used before any new measurement
+	toEmpty, _ := restored.Observe(start, State{
+		Connected: true,
+		State:     embermug.StateStable,
+		Battery:   embermug.BatteryState{Charge: 50},
+	})
+	if !durationNear(toEmpty, 25*time.Hour) {
+		t.Fatalf("toEmpty = %v after restoring, expected %v", toEmpty, 25*time.Hour)
+	}
+}
+
+// durationNear compares durations computed from floating point rates
+func durationNear(actual, expected time.Duration) bool {
+	return (actual - expected).Abs() < time.Millisecond
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+const (
+	clockCheckInterval = time.Minute      // How often the host clock is checked for changes
+	clockJumpThreshold = 30 * time.Second // Minimum wall clock jump which triggers a sync
+)
+
+// hostLocation returns the current host timezone. Unlike [time.Local], which
+// is loaded once at startup, this re-reads /etc/localtime so timezone changes
+// are observed by a running service. If TZ is set in the environment or the
+// zone file cannot be read, [time.Local] is returned.
+func hostLocation() *time.Location {
+	if _, ok := os.LookupEnv("TZ"); ok {
+		return time.Local
+	} else if data, err := os.ReadFile("/etc/localtime"); err != nil {
+		return time.Local
+	} else if loc, err := time.LoadLocationFromTZData("Local", data); err != nil {
+		return time.Local
+	} else {
+		return loc
+	}
+}
+
+// syncClockLocked measures the drift of the mug clock, and then sets the mug
+// clock to the current host time and timezone. You must hold the mug lock
+// before invoking this method.
+func (s *Service) syncClockLocked(mug *embermug.Mug, reason string) {
+	var now = time.Now().In(hostLocation())
+
+	if mugTime, err := mug.GetTime(); err != nil {
+		slog.Warn("Could not read mug clock", "Error", err)
+	} else {
+		s.state.ClockDrift = mugTime.Sub(now).Round(time.Second)
+		slog.Debug("Measured mug clock drift", "Drift", s.state.ClockDrift, "MugTime", mugTime)
+	}
+
+	if err := mug.SetTime(now); err != nil {
+		slog.Error("Could not synchronize mug clock", "Reason", reason, "Error", err)
+		return
+	}
+
+	slog.Info("Synchronized mug clock", "Reason", reason, "Drift", s.state.ClockDrift)
+}
+
+// runClockWatcher synchronizes the mug clock whenever the host timezone
+// changes, or the wall clock jumps relative to the monotonic clock. The
+// latter happens when the host resumes from suspend (the monotonic clock
+// does not advance while suspended) or the host clock is stepped.
+func (s *Service) runClockWatcher(ctx context.Context) {
+	var (
+		ticker     = time.NewTicker(clockCheckInterval)
+		last       = time.Now()
+		_, zoneOff = last.In(hostLocation()).Zone()
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var (
+			now       = time.Now()
+			wall      = now.Round(0).Sub(last.Round(0))
+			monotonic = now.Sub(last)
+			_, offset = now.In(hostLocation()).Zone()
+			reason    string
+		)
+
+		if jump := wall - monotonic; jump > clockJumpThreshold || jump < -clockJumpThreshold {
+			reason = "clock jump or resume from suspend"
+		} else if offset != zoneOff {
+			reason = "timezone changed"
+		}
+
+		last = now
+		zoneOff = offset
+
+		if reason == "" {
+			continue
+		}
+
+		s.mugLock.Lock()
+		if s.mug != nil {
+			s.syncClockLocked(s.mug, reason)
+			s.publishLocked()
+		}
+		s.mugLock.Unlock()
+	}
+}
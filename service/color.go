@@ -0,0 +1,25 @@
+package service
+
+import (
+	"log/slog"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// SetColor sets the LED color of the connected mug
+func (s *Service) SetColor(color embermug.Color) error {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+
+	if s.mug == nil {
+		return ErrNotConnected
+	}
+
+	if err := s.mug.SetColor(color); err != nil {
+		return err
+	}
+
+	slog.Info("Changed LED color", "Red", color.Red, "Green", color.Green, "Blue", color.Blue, "Alpha", color.Alpha)
+
+	return nil
+}
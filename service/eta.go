@@ -0,0 +1,168 @@
+package service
+
+import (
+	"math"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+const (
+	etaMaxSamples = 30               // Maximum number of temperature samples used for a fit
+	etaMaxAge     = 10 * time.Minute // Samples older than this are discarded
+	etaMaxTime    = 24 * time.Hour   // Estimates beyond this are treated as unknown
+	etaMinSamples = 3                // Minimum number of samples before predicting
+	etaMinSpan    = 20 * time.Second // Minimum time covered by the samples before predicting
+)
+
+// ambientTemperature is the assumed room temperature used when fitting
+// Newton's law of cooling to the liquid temperature.
+var ambientTemperature = embermug.Celsius(22)
+
+type temperatureSample struct {
+	Time        time.Time
+	Temperature embermug.Temperature
+}
+
+// etaEstimator predicts how long it will take for the liquid in the mug to
+// reach the target temperature. While cooling, the samples are fit to
+// Newton's law of cooling (T(t) = Ta + (T0 - Ta)e^(-kt)). While heating, the
+// heater dominates, so a linear rate of change is fit instead.
+type etaEstimator struct {
+	state   embermug.State
+	samples []temperatureSample
+}
+
+// Observe records the temperature from the given state and returns the
+// estimated time until the current temperature reaches the target. Samples
+// are discarded whenever the mug changes between heating and cooling. A zero
+// duration is returned if no estimate is available.
+func (e *etaEstimator) Observe(now time.Time, state State) time.Duration {
+	if !state.Connected || (state.State != embermug.StateHeating && state.State != embermug.StateCooling) {
+		e.state = state.State
+		e.samples = e.samples[:0]
+		return 0
+	} else if state.State != e.state {
+		e.state = state.State
+		e.samples = e.samples[:0]
+	}
+
+	if n := len(e.samples); n == 0 || e.samples[n-1].Temperature != state.Current {
+		e.samples = append(e.samples, temperatureSample{
+			Time:        now,
+			Temperature: state.Current,
+		})
+	}
+
+	// Drop samples which are too old or exceed the sample limit
+	var first = 0
+	for first < len(e.samples) && (now.Sub(e.samples[first].Time) > etaMaxAge || len(e.samples)-first > etaMaxSamples) {
+		first += 1
+	}
+	e.samples = append(e.samples[:0], e.samples[first:]...)
+
+	if len(e.samples) < etaMinSamples || now.Sub(e.samples[0].Time) < etaMinSpan {
+		return 0
+	}
+
+	switch state.State {
+	case embermug.StateCooling:
+		return e.estimateCooling(state.Current, state.Target)
+	default:
+		return e.estimateHeating(state.Current, state.Target)
+	}
+}
+
+// estimateCooling fits ln(T - Ta) = ln(T0 - Ta) - kt to the samples and
+// solves for the time at which the target is reached.
+func (e *etaEstimator) estimateCooling(current, target embermug.Temperature) time.Duration {
+	var (
+		ambient = ambientTemperature.Celsius()
+		xs      = make([]float64, 0, len(e.samples))
+		ys      = make([]float64, 0, len(e.samples))
+	)
+
+	if current <= target {
+		return 0
+	} else if target.Celsius() <= ambient {
+		return 0
+	}
+
+	for _, sample := range e.samples {
+		if delta := sample.Temperature.Celsius() - ambient; delta > 0 {
+			xs = append(xs, sample.Time.Sub(e.samples[0].Time).Seconds())
+			ys = append(ys, math.Log(delta))
+		}
+	}
+
+	slope, ok := leastSquaresSlope(xs, ys)
+	if !ok || slope >= 0 {
+		return 0
+	}
+
+	seconds := math.Log((current.Celsius()-ambient)/(target.Celsius()-ambient)) / -slope
+	return etaDuration(seconds)
+}
+
+// estimateHeating fits a linear rate of change to the samples and solves
+// for the time at which the target is reached.
+func (e *etaEstimator) estimateHeating(current, target embermug.Temperature) time.Duration {
+	var (
+		xs = make([]float64, 0, len(e.samples))
+		ys = make([]float64, 0, len(e.samples))
+	)
+
+	if current >= target {
+		return 0
+	}
+
+	for _, sample := range e.samples {
+		xs = append(xs, sample.Time.Sub(e.samples[0].Time).Seconds())
+		ys = append(ys, sample.Temperature.Celsius())
+	}
+
+	slope, ok := leastSquaresSlope(xs, ys)
+	if !ok || slope <= 0 {
+		return 0
+	}
+
+	seconds := (target.Celsius() - current.Celsius()) / slope
+	return etaDuration(seconds)
+}
+
+// etaDuration converts an estimate in seconds to a duration. Estimates which
+// exceed etaMaxTime come from a nearly flat fit and would overflow the
+// conversion, so they are reported as unknown.
+func etaDuration(seconds float64) time.Duration {
+	if seconds > etaMaxTime.Seconds() {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// leastSquaresSlope returns the slope of the least squares line through
+// the given points.
+func leastSquaresSlope(xs, ys []float64) (float64, bool) {
+	var (
+		n                        = float64(len(xs))
+		sumX, sumY, sumXY, sumXX float64
+	)
+
+	if len(xs) < 2 {
+		return 0, false
+	}
+
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+func TestETAEstimator(t *testing.T) {
+	const interval = 10 * time.Second
+
+	// Newton's law of cooling from 70C towards the ambient temperature
+	var (
+		ambient = ambientTemperature.Celsius()
+		k       = 0.001
+		newton  = func(seconds float64) float64 {
+			return ambient + (70-ambient)*math.Exp(-k*seconds)
+		}
+	)
+
+	tests := []struct {
+		name        string
+		state       embermug.State
+		target      float64                       // Target temperature in celsius
+		temperature func(seconds float64) float64 // Temperature in celsius at each sample
+		samples     int
+		expected    time.Duration // Expected estimate after the last sample (zero if unknown)
+	}{
+		{
+			name:        "heating",
+			state:       embermug.StateHeating,
+			target:      57,
+			temperature: func(s float64) float64 { return 40 + 0.1*s },
+			samples:     6,
+			expected:    120 * time.Second,
+		},
+		{
+			name:        "heating with noise",
+			state:       embermug.StateHeating,
+			target:      57,
+			temperature: func(s float64) float64 { return 40 + 0.1*s + 0.05*math.Sin(s) },
+			samples:     12,
+			expected:    (57 - 40 - 0.1*110) / 0.1 * time.Second,
+		},
+		{
+			name:        "cooling",
+			state:       embermug.StateCooling,
+			target:      60,
+			temperature: newton,
+			samples:     6,
+			expected:    time.Duration((math.Log(48.0/38.0)/k - 50) * float64(time.Second)),
+		},
+		{
+			name:        "flat",
+			state:       embermug.StateHeating,
+			target:      57,
+			temperature: func(s float64) float64 { return 50 },
+			samples:     10,
+		},
+		{
+			name:        "flat with noise",
+			state:       embermug.StateHeating,
+			target:      57,
+			temperature: func(s float64) float64 { return 50 + 0.01*float64(int(s/10)%2) },
+			samples:     10,
+		},
+		{
+			name:        "falling while heating",
+			state:       embermug.StateHeating,
+			target:      57,
+			temperature: func(s float64) float64 { return 50 - 0.1*s },
+			samples:     6,
+		},
+		{
+			name:        "rising while cooling",
+			state:       embermug.StateCooling,
+			target:      50,
+			temperature: func(s float64) float64 { return 60 + 0.1*s },
+			samples:     6,
+		},
+		{
+			name:        "heating target reached",
+			state:       embermug.StateHeating,
+			target:      45,
+			temperature: func(s float64) float64 { return 40 + 0.1*s },
+			samples:     6,
+		},
+		{
+			name:        "cooling target reached",
+			state:       embermug.StateCooling,
+			target:      65,
+			temperature: func(s float64) float64 { return 62 - 0.1*s },
+			samples:     6,
+		},
+		{
+			name:        "cooling target below ambient",
+			state:       embermug.StateCooling,
+			target:      ambient - 1,
+			temperature: newton,
+			samples:     6,
+		},
+		{
+			name:        "too few samples",
+			state:       embermug.StateHeating,
+			target:      57,
+			temperature: func(s float64) float64 { return 40 + 0.1*s },
+			samples:     etaMinSamples - 1,
+		},
+		{
+			name:        "stable",
+			state:       embermug.StateStable,
+			target:      57,
+			temperature: func(s float64) float64 { return 40 + 0.1*s },
+			samples:     6,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				estimator etaEstimator
+				start     = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+				eta       time.Duration
+			)
+
+			for i := range test.samples {
+				offset := time.Duration(i) * interval
+				eta = estimator.Observe(start.Add(offset), State{
+					Connected: true,
+					State:     test.state,
+					Current:   embermug.Celsius(test.temperature(offset.Seconds())),
+					Target:    embermug.Celsius(test.target),
+				})
+			}
+
+			if test.expected == 0 {
+				if eta != 0 {
+					t.Fatalf("ETA = %v, expected no estimate", eta)
+				}
+				return
+			}
+
+			// Temperatures are stored in hundredths of a degree
+			if tolerance := test.expected / 20; eta < test.expected-tolerance || eta > test.expected+tolerance {
+				t.Fatalf("ETA = %v, expected %v", eta, test.expected)
+			}
+		})
+	}
+}
+
+func TestETAEstimatorResets(t *testing.T) {
+	var (
+		estimator etaEstimator
+		start     = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+		observe   = func(i int, state embermug.State, connected bool) time.Duration {
+			return estimator.Observe(start.Add(time.Duration(i)*10*time.Second), State{
+				Connected: connected,
+				State:     state,
+				Current:   embermug.Celsius(40 + float64(i)),
+				Target:    embermug.Celsius(57),
+			})
+		}
+	)
+
+	for i := range 5 {
+		observe(i, embermug.StateHeating, true)
+	}
+	if eta := observe(5, embermug.StateHeating, true); eta == 0 {
+		t.Fatal("no estimate while heating")
+	}
+
+	// Disconnecting discards the samples
+	if eta := observe(6, embermug.StateHeating, false); eta != 0 {
+		t.Fatalf("ETA = %v while disconnected", eta)
+	}
+	if eta := observe(7, embermug.StateHeating, true); eta != 0 {
+		t.Fatalf("ETA = %v from samples before the disconnect", eta)
+	}
+
+	// Switching between heating and cooling discards the samples
+	if eta := observe(8, embermug.StateCooling, true); eta != 0 {
+		t.Fatalf("ETA = %v from samples while heating", eta)
+	}
+}
+
+func TestETAEstimatorDropsOldSamples(t *testing.T) {
+	var (
+		estimator etaEstimator
+		start     = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	)
+
+	// A long, slow heat up followed by a fast one
+	for i := range 100 {
+		var (
+			seconds = float64(i * 10)
+			current = 30 + 0.001*seconds
+		)
+		if i >= 80 {
+			current = 30 + 0.001*790 + 0.1*(seconds-790)
+		}
+
+		estimator.Observe(start.Add(time.Duration(i)*10*time.Second), State{
+			Connected: true,
+			State:     embermug.StateHeating,
+			Current:   embermug.Celsius(current),
+			Target:    embermug.Celsius(57),
+		})
+	}
+
+	if len(estimator.samples) > etaMaxSamples {
+		t.Fatalf("%v samples retained, expected at most %v", len(estimator.samples), etaMaxSamples)
+	}
+	if age := estimator.samples[len(estimator.samples)-1].Time.Sub(estimator.samples[0].Time); age > etaMaxAge {
+		t.Fatalf("samples span %v, expected at most %v", age, etaMaxAge)
+	}
+}
+
+func TestETADuration(t *testing.T) {
+	tests := []struct {
+		seconds  float64
+		expected time.Duration
+	}{
+		{seconds: 90, expected: 90 * time.Second},
+		{seconds: etaMaxTime.Seconds(), expected: etaMaxTime},
+		{seconds: etaMaxTime.Seconds() + 1, expected: 0},
+		// Would overflow the conversion to a duration
+		{seconds: 1e12, expected: 0},
+		{seconds: math.Inf(1), expected: 0},
+	}
+
+	for _, test := range tests {
+		if eta := etaDuration(test.seconds); eta != test.expected {
+			t.Errorf("etaDuration(%v) = %v, expected %v", test.seconds, eta, test.expected)
+		}
+	}
+}
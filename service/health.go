@@ -0,0 +1,30 @@
+package service
+
+import "time"
+
+// Responsive reports whether the bluetooth event loop is making progress. It
+// is not responsive if the mug lock, which every bluetooth operation holds,
+// cannot be acquired within the timeout, or if fallback polling is enabled
+// and the connected mug has neither sent an event nor been polled for twice
+// the poll interval.
+//
+// A wedged operation keeps holding the lock, so each failed check leaves a
+// goroutine waiting for it. Callers are expected to give up on the service
+// (e.g. by withholding watchdog pings) rather than checking indefinitely.
+func (s *Service) Responsive(timeout time.Duration) bool {
+	var result = make(chan bool, 1)
+
+	go func() {
+		s.mugLock.Lock()
+		defer s.mugLock.Unlock()
+
+		result <- s.mug == nil || s.poll.Interval <= 0 || time.Since(s.lastEvent) < 2*s.pollIntervalLocked()
+	}()
+
+	select {
+	case responsive := <-result:
+		return responsive
+	case <-time.After(timeout):
+		return false
+	}
+}
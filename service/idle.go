@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// idleTracker counts the connected socket clients, and records when the
+// service last became idle.
+type idleTracker struct {
+	timeout time.Duration // Time without socket clients before the service stops (zero disables)
+	lock    sync.Mutex
+	clients int       // Connected socket clients
+	since   time.Time // Time the last socket client disconnected
+}
+
+func (t *idleTracker) connected() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.clients += 1
+}
+
+func (t *idleTracker) disconnected() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.clients -= 1
+	if t.clients == 0 {
+		t.since = time.Now()
+	}
+}
+
+// idleFor returns how long the service has been without socket clients
+func (t *idleTracker) idleFor(now time.Time) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.clients > 0 {
+		return 0
+	}
+	return now.Sub(t.since)
+}
+
+// runIdleMonitor stops the service once it has had no socket clients for
+// the idle timeout. It runs until the context is cancelled.
+func (s *Service) runIdleMonitor(ctx context.Context, stop context.CancelFunc) {
+	s.idle.lock.Lock()
+	s.idle.since = time.Now()
+	s.idle.lock.Unlock()
+
+	var timer = time.NewTimer(s.idle.timeout)
+	defer timer.Stop()
+
+	slog.Debug("Starting idle monitor", "Timeout", s.idle.timeout)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			idle := s.idle.idleFor(now)
+			if idle >= s.idle.timeout {
+				slog.Info("No clients connected. Stopping idle service.", "Idle", idle)
+				stop()
+				return
+			}
+
+			timer.Reset(s.idle.timeout - idle)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// Listener is a socket where [Service.Run] accepts clients
+type Listener struct {
+	net.Listener
+
+	// ReadOnly limits clients of this listener to the [RoleReadOnly] role,
+	// regardless of the access rules.
+	ReadOnly bool
+
+	// Handshake optionally authenticates each new connection before it is
+	// served, and may return a wrapped connection. Connections are closed if
+	// the handshake fails.
+	Handshake func(ctx context.Context, conn net.Conn) (io.ReadWriteCloser, error)
+}
+
+// acceptClients accepts clients from the listener, and serves each one in the
+// background until the listener is closed. Errors after the context is done
+// are the result of the listener closing, and are not reported.
+func (s *Service) acceptClients(ctx context.Context, listener Listener, group *sync.WaitGroup) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			s.serveConn(ctx, listener, conn)
+		}()
+	}
+}
+
+// serveConn authorizes a newly accepted connection, completes the listener
+// handshake, and serves the client with the resulting role.
+func (s *Service) serveConn(ctx context.Context, listener Listener, conn net.Conn) {
+	var logger = slog.With("Listener", listener.Addr(), "RemoteAddr", conn.RemoteAddr())
+
+	// Clients without access are dropped before they receive any state
+	role := s.authorize(conn, logger)
+	if role == RoleDenied {
+		conn.Close()
+		return
+	} else if listener.ReadOnly {
+		role = min(role, RoleReadOnly)
+	}
+
+	var client io.ReadWriteCloser = conn
+	if listener.Handshake != nil {
+		if wrapped, err := listener.Handshake(ctx, conn); err != nil {
+			logger.Warn("Rejected client", "Error", err)
+			conn.Close()
+			return
+		} else {
+			client = wrapped
+		}
+	}
+
+	s.handleClient(ctx, client, role)
+}
@@ -1,5 +1,28 @@
 package service
 
+import "github.com/calebstewart/go-embermug"
+
 type Message struct {
-	Reconnect bool // Whether to initiate a bluetooth reconnect
+	ID           string               // Optional identifier. Messages with an ID receive a Reply.
+	Reconnect    bool                 // Whether to initiate a bluetooth reconnect
+	ApplyPreset  string               // Name of a configured preset to apply to the mug
+	SetTarget    embermug.Temperature // New target temperature (zero leaves the target unchanged)
+	AdjustTarget embermug.Temperature // Amount to add to the current target temperature
+	SetColor     *embermug.Color      // New LED color
+	SetName      string               // New mug name (at most 14 bytes)
+}
+
+// Update is the object written to socket clients. It always carries the
+// most recent mug [State], so clients which only care about the state can
+// decode updates directly into a [State]. Updates sent in response to a
+// [Message] with an ID additionally carry a [Reply].
+type Update struct {
+	State
+	Reply *Reply `json:",omitempty"`
+}
+
+// Reply describes the outcome of a client [Message].
+type Reply struct {
+	ID    string // ID of the message this reply is for
+	Error string `json:",omitempty"` // Reason the message failed (empty on success)
 }
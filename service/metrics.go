@@ -0,0 +1,112 @@
+package service
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// Names of the commands in a [Message], as reported in [Metrics.Commands]
+const (
+	CommandReconnect    = "reconnect"
+	CommandApplyPreset  = "apply-preset"
+	CommandSetTarget    = "set-target"
+	CommandAdjustTarget = "adjust-target"
+	CommandSetColor     = "set-color"
+	CommandSetName      = "set-name"
+)
+
+// CommandOutcome identifies a command and whether it succeeded
+type CommandOutcome struct {
+	Command string
+	Success bool
+}
+
+// Metrics is a snapshot of the service counters. Counters start at zero when
+// the service is created.
+type Metrics struct {
+	Events          map[embermug.Event]uint64 // Mug events received, by event type
+	ConnectAttempts uint64                    // Bluetooth connection attempts
+	ConnectFailures uint64                    // Bluetooth connection attempts which failed
+	Clients         int                       // Currently registered clients
+	ClientsTotal    uint64                    // Clients registered since the service started
+	DroppedUpdates  uint64                    // States dropped because a client was not keeping up
+	Commands        map[CommandOutcome]uint64 // Executed commands, by command and outcome
+}
+
+// metrics holds the service counters. It has its own lock, so counters can
+// be updated while holding either the mug or client lock.
+type metrics struct {
+	lock sync.Mutex
+	Metrics
+}
+
+func (m *metrics) event(event embermug.Event) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Events == nil {
+		m.Events = make(map[embermug.Event]uint64)
+	}
+	m.Events[event] += 1
+}
+
+func (m *metrics) connectAttempt(err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.ConnectAttempts += 1
+	if err != nil {
+		m.ConnectFailures += 1
+	}
+}
+
+func (m *metrics) clientRegistered() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.ClientsTotal += 1
+}
+
+func (m *metrics) updateDropped() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.DroppedUpdates += 1
+}
+
+// command records the outcome of a command, and returns the error unchanged
+func (m *metrics) command(command string, err error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Commands == nil {
+		m.Commands = make(map[CommandOutcome]uint64)
+	}
+	m.Commands[CommandOutcome{Command: command, Success: err == nil}] += 1
+
+	return err
+}
+
+// Metrics returns a snapshot of the service counters
+func (s *Service) Metrics() Metrics {
+	s.clientLock.Lock()
+	var clients = 0
+	for _, client := range s.clients {
+		if client.Context.Err() == nil {
+			clients += 1
+		}
+	}
+	s.clientLock.Unlock()
+
+	s.metrics.lock.Lock()
+	defer s.metrics.lock.Unlock()
+
+	var snapshot = s.metrics.Metrics
+	snapshot.Events = maps.Clone(snapshot.Events)
+	snapshot.Commands = maps.Clone(snapshot.Commands)
+	snapshot.Clients = clients
+
+	return snapshot
+}
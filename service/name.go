@@ -0,0 +1,26 @@
+package service
+
+import (
+	"log/slog"
+)
+
+// SetName changes the name the connected mug advertises
+func (s *Service) SetName(name string) error {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+
+	if s.mug == nil {
+		return ErrNotConnected
+	}
+
+	if err := s.mug.SetName(name); err != nil {
+		return err
+	}
+
+	slog.Info("Changed mug name", "Name", name)
+
+	s.state.Name = name
+	s.publishLocked()
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures optional behavior of a [Service]. Options are applied
+// in order by [New].
+type Option func(s *Service)
+
+// WithPolling enables the fallback polling of mug characteristics using
+// the given configuration. See [PollConfig] for details.
+func WithPolling(cfg PollConfig) Option {
+	return func(s *Service) {
+		s.poll = cfg
+	}
+}
+
+// WithBatteryEstimates persists the learned battery charge and discharge
+// rates at the given path, so time-to-empty and time-to-full estimates
+// survive restarts. Without this option, rates are only learned in memory.
+func WithBatteryEstimates(path string) Option {
+	return func(s *Service) {
+		if err := s.battery.Load(path); err != nil {
+			slog.Warn("Could not load battery estimates", "Path", path, "Error", err)
+		}
+	}
+}
+
+// WithSessions appends completed drink sessions to the file at the given
+// path, and loads the number of sessions started today from it. Without
+// this option, sessions are still detected but are not recorded.
+func WithSessions(path string) Option {
+	return func(s *Service) {
+		if err := s.sessions.Load(path, time.Now()); err != nil {
+			slog.Warn("Could not load drink sessions", "Path", path, "Error", err)
+		}
+	}
+}
+
+// WithPresets registers named presets which clients can apply to the mug.
+// The service also reports which preset matches the current target.
+func WithPresets(presets ...Preset) Option {
+	return func(s *Service) {
+		s.presets = append(s.presets, presets...)
+		sortPresets(s.presets)
+	}
+}
+
+// WithSchedule registers rules which change the target temperature at
+// specific times of day. See [ScheduleRule] for details.
+func WithSchedule(rules ...ScheduleRule) Option {
+	return func(s *Service) {
+		s.schedule.rules = append(s.schedule.rules, rules...)
+	}
+}
+
+// WithScheduleCatchUp applies the most recent schedule rule when the service
+// starts, rather than waiting for the next rule to fire. This overrides any
+// target set by hand since that rule fired, including across restarts.
+func WithScheduleCatchUp() Option {
+	return func(s *Service) {
+		s.schedule.catchUp = true
+	}
+}
+
+// WithClockSync synchronizes the mug clock with the host whenever the mug
+// connects, the host timezone changes, or the host resumes from suspend.
+func WithClockSync() Option {
+	return func(s *Service) {
+		s.syncClock = true
+	}
+}
+
+// WithAccessRules restricts socket clients to those matching one of the
+// given rules, which are checked against the peer credentials of each
+// connection. See [AccessRule] for details.
+func WithAccessRules(rules ...AccessRule) Option {
+	return func(s *Service) {
+		s.access = append(s.access, rules...)
+	}
+}
+
+// WithIdleTimeout stops the service once no socket clients have been
+// connected for the given duration, such as when the service is started on
+// demand by socket activation. Clients registered with
+// [Service.RegisterClient] do not keep the service running.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		s.idle.timeout = timeout
+	}
+}
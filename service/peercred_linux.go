@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var ErrNoPeerCredentials = errors.New("connection does not carry peer credentials")
+
+// ReadPeerCredentials reads the SO_PEERCRED credentials of a unix socket
+// connection. Supplementary groups are read from procfs on a best effort
+// basis.
+func ReadPeerCredentials(conn net.Conn) (PeerCredentials, error) {
+	var cred PeerCredentials
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return cred, fmt.Errorf("%w: %v", ErrNoPeerCredentials, conn.RemoteAddr())
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return cred, err
+	}
+
+	var (
+		ucred    *syscall.Ucred
+		ucredErr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		ucred, ucredErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return cred, err
+	} else if ucredErr != nil {
+		return cred, ucredErr
+	}
+
+	cred.PID = ucred.Pid
+	cred.UID = ucred.Uid
+	cred.GID = ucred.Gid
+	cred.Groups = processGroups(ucred.Pid)
+
+	return cred, nil
+}
+
+// processGroups returns the supplementary groups of a process, or nil if
+// they cannot be read.
+func processGroups(pid int32) []uint32 {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var scanner = bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields, ok := strings.CutPrefix(scanner.Text(), "Groups:")
+		if !ok {
+			continue
+		}
+
+		var groups []uint32
+		for _, field := range strings.Fields(fields) {
+			if gid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				groups = append(groups, uint32(gid))
+			}
+		}
+		return groups
+	}
+
+	return nil
+}
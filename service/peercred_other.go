@@ -0,0 +1,16 @@
+//go:build !linux
+
+package service
+
+import (
+	"errors"
+	"net"
+)
+
+var ErrNoPeerCredentials = errors.New("peer credentials are not supported on this platform")
+
+// ReadPeerCredentials reads the credentials of a unix socket connection.
+// This is only supported on Linux.
+func ReadPeerCredentials(conn net.Conn) (PeerCredentials, error) {
+	return PeerCredentials{}, ErrNoPeerCredentials
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// PollConfig controls the fallback polling of mug characteristics. Some
+// bluetooth stacks silently stop delivering event notifications, which
+// would otherwise freeze the reported state. When no event has arrived
+// within the active interval, the service reads the state, temperature,
+// target, level and battery characteristics itself.
+type PollConfig struct {
+	Interval     time.Duration // Poll when no event was received in this window (zero disables polling)
+	IdleInterval time.Duration // Window used while the mug is empty or charging (defaults to Interval)
+}
+
+// pollEvents are the events synthesized by the poller. Each one is processed
+// through the same change-detection path as a real mug event.
+var pollEvents = []embermug.Event{
+	embermug.EventRefreshState,
+	embermug.EventRefreshTemperature,
+	embermug.EventRefreshTarget,
+	embermug.EventRefreshLevel,
+	embermug.EventRefreshBattery,
+}
+
+// runPoller polls the mug whenever the event stream has been quiet for longer
+// than the active poll interval. It runs until the context is cancelled.
+func (s *Service) runPoller(ctx context.Context) {
+	var timer = time.NewTimer(s.poll.Interval)
+	defer timer.Stop()
+
+	slog.Debug("Starting fallback poller", "Interval", s.poll.Interval, "IdleInterval", s.poll.IdleInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(s.pollIfStale())
+		}
+	}
+}
+
+// pollIfStale polls the mug if the last event is older than the active
+// interval, and returns the duration to wait before checking again.
+func (s *Service) pollIfStale() time.Duration {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+
+	var (
+		interval = s.pollIntervalLocked()
+		elapsed  = time.Since(s.lastEvent)
+		mug      = s.mug
+	)
+
+	if mug == nil {
+		return interval
+	} else if elapsed < interval {
+		return interval - elapsed
+	}
+
+	slog.Debug("No mug events received recently; polling characteristics", "Elapsed", elapsed)
+
+	var changed = false
+	for _, event := range pollEvents {
+		if s.refreshLocked(mug, event) {
+			changed = true
+		}
+	}
+
+	s.lastEvent = time.Now()
+
+	if changed {
+		s.publishLocked()
+	}
+
+	return interval
+}
+
+// pollIntervalLocked returns the poll interval appropriate for the current
+// mug state. The poller backs off while the mug is idle or on the charger
+// since the state is not expected to change much. You must hold the mug lock
+// before invoking this method.
+func (s *Service) pollIntervalLocked() time.Duration {
+	if s.poll.IdleInterval <= 0 {
+		return s.poll.Interval
+	}
+
+	switch {
+	case s.state.Battery.Charging:
+		return s.poll.IdleInterval
+	case !s.state.HasLiquid, s.state.State == embermug.StateEmpty:
+		return s.poll.IdleInterval
+	default:
+		return s.poll.Interval
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// presetTolerance is the maximum difference between the mug target and a
+// preset for the preset to be considered active. The mug stores the target
+// in hundredths of a degree celsius, so presets defined in fahrenheit do not
+// round-trip exactly.
+const presetTolerance = embermug.Temperature(25)
+
+var (
+	ErrNotConnected  = errors.New("mug is not connected")
+	ErrUnknownPreset = errors.New("unknown preset")
+)
+
+// Preset is a named target temperature with an optional LED color, such
+// as a preferred temperature for a specific beverage.
+type Preset struct {
+	Name   string               // Unique name of the preset
+	Target embermug.Temperature // Target temperature
+	Color  *embermug.Color      // Optional LED color
+}
+
+// ApplyPreset sets the target temperature (and LED color if defined) of the
+// connected mug to the values from the named preset. Preset names are
+// matched case-insensitively.
+func (s *Service) ApplyPreset(name string) error {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+
+	return s.applyPresetLocked(name)
+}
+
+// applyPresetLocked applies the named preset. You must hold the mug lock
+// before invoking this method.
+func (s *Service) applyPresetLocked(name string) error {
+	var index = slices.IndexFunc(s.presets, func(p Preset) bool {
+		return strings.EqualFold(p.Name, name)
+	})
+	if index == -1 {
+		return ErrUnknownPreset
+	}
+
+	var preset = s.presets[index]
+	if s.mug == nil {
+		return ErrNotConnected
+	}
+
+	if err := s.setTargetLocked(preset.Target); err != nil {
+		return err
+	}
+
+	if preset.Color != nil {
+		if err := s.mug.SetColor(*preset.Color); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Applied preset", "Preset", preset.Name, "TargetF", preset.Target.Fahrenheit())
+
+	return nil
+}
+
+// matchPreset returns the name of the first preset (ordered by name) with
+// the given target temperature, or an empty string if none match.
+func (s *Service) matchPreset(target embermug.Temperature) string {
+	for _, preset := range s.presets {
+		if math.Abs(float64(preset.Target-target)) <= float64(presetTolerance) {
+			return preset.Name
+		}
+	}
+
+	return ""
+}
+
+// sortPresets orders presets by name so preset matching is deterministic
+func sortPresets(presets []Preset) {
+	slices.SortFunc(presets, func(a, b Preset) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
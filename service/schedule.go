@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// ScheduleRule changes the target temperature (and optionally the LED color)
+// at a specific time of day. A rule only takes effect while the mug is
+// connected and has liquid. If the mug is disconnected or empty when a rule
+// fires, the change is applied once the mug is connected and filled.
+type ScheduleRule struct {
+	Hour   int                  // Hour of the day (0-23) the rule fires at
+	Minute int                  // Minute of the hour (0-59) the rule fires at
+	Days   []time.Weekday       // Days the rule fires on (empty for every day)
+	Target embermug.Temperature // Target temperature to apply
+	Color  *embermug.Color      // Optional LED color to apply
+}
+
+// ScheduledChange describes an upcoming change from the schedule.
+type ScheduledChange struct {
+	Time   time.Time            // Time the change will be made (zero if nothing is scheduled)
+	Target embermug.Temperature // Target temperature which will be applied
+}
+
+// scheduler tracks the next rule to fire and the pending change which has
+// fired but not been applied yet.
+type scheduler struct {
+	rules   []ScheduleRule
+	catchUp bool          // Apply the most recent rule when the scheduler starts
+	pending *ScheduleRule // Rule which fired but has not been applied
+	next    ScheduledChange
+}
+
+// occursOn returns true if the rule fires on the given day
+func (r *ScheduleRule) occursOn(day time.Weekday) bool {
+	return len(r.Days) == 0 || slices.Contains(r.Days, day)
+}
+
+// at returns the time this rule fires on the date of the given day. If the
+// clocks skip over the rule's time (e.g. 02:30 when daylight saving time
+// starts), it fires the same time after the change (e.g. 03:30).
+func (r *ScheduleRule) at(day time.Time) time.Time {
+	year, month, date := day.Date()
+
+	var (
+		t    = time.Date(year, month, date, r.Hour, r.Minute, 0, 0, day.Location())
+		want = time.Date(year, month, date, r.Hour, r.Minute, 0, 0, time.UTC)
+		wall = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	)
+
+	// A skipped time may be normalized using the offset from after the
+	// change, which lands before the change.
+	if wall.Before(want) {
+		t = t.Add(want.Sub(wall))
+	}
+
+	return t
+}
+
+// next returns the first time strictly after now which the rule fires at
+func (r *ScheduleRule) next(now time.Time) (time.Time, bool) {
+	for offset := 0; offset <= 7; offset++ {
+		if t := r.at(now.AddDate(0, 0, offset)); t.After(now) && r.occursOn(t.Weekday()) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// previous returns the last time at or before now which the rule fired at
+func (r *ScheduleRule) previous(now time.Time) (time.Time, bool) {
+	for offset := 0; offset <= 7; offset++ {
+		if t := r.at(now.AddDate(0, 0, -offset)); !t.After(now) && r.occursOn(t.Weekday()) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nextRule returns the rule which fires next after now
+func (s *scheduler) nextRule(now time.Time) (rule *ScheduleRule, at time.Time) {
+	for i := range s.rules {
+		if t, ok := s.rules[i].next(now); ok && (rule == nil || t.Before(at)) {
+			rule, at = &s.rules[i], t
+		}
+	}
+	return rule, at
+}
+
+// currentRule returns the rule which fired most recently at or before now
+func (s *scheduler) currentRule(now time.Time) *ScheduleRule {
+	var (
+		rule *ScheduleRule
+		at   time.Time
+	)
+
+	for i := range s.rules {
+		if t, ok := s.rules[i].previous(now); ok && (rule == nil || t.After(at)) {
+			rule, at = &s.rules[i], t
+		}
+	}
+
+	return rule
+}
+
+// runScheduler fires schedule rules at their configured times until the
+// context is cancelled. Only rules which fire after the service starts are
+// applied, unless catching up is enabled. Then, the rule active when the
+// service starts is also applied once the mug is connected and has liquid.
+func (s *Service) runScheduler(ctx context.Context) {
+	if s.schedule.catchUp {
+		s.mugLock.Lock()
+		s.schedule.pending = s.schedule.currentRule(time.Now())
+		s.mugLock.Unlock()
+	}
+
+	for {
+		s.mugLock.Lock()
+		rule, at := s.schedule.nextRule(time.Now())
+		if rule == nil {
+			s.schedule.next = ScheduledChange{}
+		} else {
+			s.schedule.next = ScheduledChange{Time: at, Target: rule.Target}
+		}
+		s.publishLocked()
+		s.mugLock.Unlock()
+
+		if rule == nil {
+			return
+		}
+
+		slog.Debug("Next scheduled target change", "Time", at, "TargetF", rule.Target.Fahrenheit())
+
+		// Wake up at least once a minute, since the monotonic clock used
+		// by timers does not advance while the system is suspended.
+		for time.Now().Before(at) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(min(time.Until(at), time.Minute)):
+			}
+		}
+
+		s.mugLock.Lock()
+		slog.Info("Scheduled target change fired", "TargetF", rule.Target.Fahrenheit())
+		s.schedule.pending = rule
+		s.mugLock.Unlock()
+	}
+}
+
+// applyScheduleLocked applies the pending scheduled change if the mug is
+// connected and has liquid. You must hold the mug lock before invoking this
+// method.
+func (s *Service) applyScheduleLocked() {
+	var rule = s.schedule.pending
+	if rule == nil || s.mug == nil || !s.state.Connected || !s.state.HasLiquid {
+		return
+	}
+
+	// The change is only attempted once. If it fails, the next rule
+	// will try again. Clearing it first also keeps the state published
+	// by setTargetLocked from applying it again.
+	s.schedule.pending = nil
+
+	if err := s.setTargetLocked(rule.Target); err != nil {
+		slog.Error("Could not apply scheduled target temperature", "Error", err)
+		return
+	}
+
+	if rule.Color != nil {
+		if err := s.mug.SetColor(*rule.Color); err != nil {
+			slog.Error("Could not apply scheduled color", "Error", err)
+		}
+	}
+
+	slog.Info("Applied scheduled target temperature", "TargetF", rule.Target.Fahrenheit())
+}
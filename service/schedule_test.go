@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+	"tinygo.org/x/bluetooth"
+)
+
+var (
+	weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	weekends = []time.Weekday{time.Saturday, time.Sunday}
+)
+
+func TestScheduleRuleNext(t *testing.T) {
+	// Friday the 8th through Monday the 11th of March 2024
+	var at = func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     ScheduleRule
+		now      time.Time
+		next     time.Time
+		previous time.Time
+	}{
+		{
+			name:     "every day",
+			rule:     ScheduleRule{Hour: 7, Minute: 30},
+			now:      at(8, 12, 0),
+			next:     at(9, 7, 30),
+			previous: at(8, 7, 30),
+		},
+		{
+			name:     "later today",
+			rule:     ScheduleRule{Hour: 13, Minute: 0},
+			now:      at(8, 12, 0),
+			next:     at(8, 13, 0),
+			previous: at(7, 13, 0),
+		},
+		{
+			// A rule fires at, but not after, the current minute
+			name:     "current minute",
+			rule:     ScheduleRule{Hour: 12, Minute: 0},
+			now:      at(8, 12, 0),
+			next:     at(9, 12, 0),
+			previous: at(8, 12, 0),
+		},
+		{
+			name:     "weekdays from friday",
+			rule:     ScheduleRule{Hour: 7, Minute: 30, Days: weekdays},
+			now:      at(8, 12, 0),
+			next:     at(11, 7, 30),
+			previous: at(8, 7, 30),
+		},
+		{
+			name:     "weekdays from sunday",
+			rule:     ScheduleRule{Hour: 7, Minute: 30, Days: weekdays},
+			now:      at(10, 12, 0),
+			next:     at(11, 7, 30),
+			previous: at(8, 7, 30),
+		},
+		{
+			name:     "weekends from friday",
+			rule:     ScheduleRule{Hour: 9, Minute: 0, Days: weekends},
+			now:      at(8, 12, 0),
+			next:     at(9, 9, 0),
+			previous: at(3, 9, 0),
+		},
+		{
+			name:     "weekends from saturday",
+			rule:     ScheduleRule{Hour: 9, Minute: 0, Days: weekends},
+			now:      at(9, 12, 0),
+			next:     at(10, 9, 0),
+			previous: at(9, 9, 0),
+		},
+		{
+			// A rule on a single day fires again a week later
+			name:     "once a week",
+			rule:     ScheduleRule{Hour: 12, Minute: 0, Days: []time.Weekday{time.Friday}},
+			now:      at(8, 12, 0),
+			next:     at(15, 12, 0),
+			previous: at(8, 12, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if next, ok := test.rule.next(test.now); !ok || !next.Equal(test.next) {
+				t.Errorf("next = %v, %v, expected %v", next, ok, test.next)
+			}
+			if previous, ok := test.rule.previous(test.now); !ok || !previous.Equal(test.previous) {
+				t.Errorf("previous = %v, %v, expected %v", previous, ok, test.previous)
+			}
+		})
+	}
+}
+
+func TestScheduleRuleDST(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone database is not available: %v", err)
+	}
+
+	var at = func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, location)
+	}
+
+	// Clocks skip from 02:00 EST to 03:00 EDT on March 10th
+	rule := ScheduleRule{Hour: 2, Minute: 30}
+	if next, _ := rule.next(at(time.March, 10, 1, 0)); !next.Equal(at(time.March, 10, 3, 30)) {
+		t.Errorf("next = %v across the skipped hour, expected 03:30 EDT", next)
+	}
+	if next, _ := rule.next(at(time.March, 10, 4, 0)); !next.Equal(at(time.March, 11, 2, 30)) {
+		t.Errorf("next = %v after the skipped hour, expected the following day", next)
+	}
+
+	// A rule in local time keeps its wall clock time across the change
+	rule = ScheduleRule{Hour: 7, Minute: 0}
+	if next, _ := rule.next(at(time.March, 9, 12, 0)); next.Hour() != 7 || next.Sub(at(time.March, 9, 7, 0)) != 23*time.Hour {
+		t.Errorf("next = %v across the change, expected 07:00 EDT", next)
+	}
+
+	// Clocks repeat 01:00-02:00 on November 3rd, and the rule only fires
+	// during the first pass.
+	var (
+		rule130  = ScheduleRule{Hour: 1, Minute: 30}
+		first    = at(time.November, 3, 1, 30)
+		repeated = first.Add(75 * time.Minute) // 01:45 EST
+	)
+	if next, _ := rule130.next(at(time.November, 3, 0, 0)); !next.Equal(first) {
+		t.Errorf("next = %v, expected %v", next, first)
+	}
+	if next, _ := rule130.next(repeated); !next.Equal(at(time.November, 4, 1, 30)) {
+		t.Errorf("next = %v during the repeated hour, expected the following day", next)
+	}
+	if previous, _ := rule130.previous(repeated); !previous.Equal(first) {
+		t.Errorf("previous = %v during the repeated hour, expected %v", previous, first)
+	}
+}
+
+func TestSchedulerRules(t *testing.T) {
+	var (
+		now      = time.Date(2024, time.March, 8, 12, 0, 0, 0, time.UTC) // Friday
+		schedule = scheduler{rules: []ScheduleRule{
+			{Hour: 7, Minute: 0, Days: weekdays, Target: embermug.Celsius(60)},
+			{Hour: 9, Minute: 0, Days: weekends, Target: embermug.Celsius(55)},
+			{Hour: 14, Minute: 0, Target: embermug.Celsius(50)},
+		}}
+	)
+
+	tests := []struct {
+		now     time.Time
+		next    *ScheduleRule
+		at      time.Time
+		current *ScheduleRule
+	}{
+		{now: now, next: &schedule.rules[2], at: now.Add(2 * time.Hour), current: &schedule.rules[0]},
+		{now: now.Add(3 * time.Hour), next: &schedule.rules[1], at: now.Add(21 * time.Hour), current: &schedule.rules[2]},
+		{now: now.Add(24 * time.Hour), next: &schedule.rules[2], at: now.Add(26 * time.Hour), current: &schedule.rules[1]},
+		{now: now.AddDate(0, 0, 2).Add(3 * time.Hour), next: &schedule.rules[0], at: now.AddDate(0, 0, 3).Add(-5 * time.Hour), current: &schedule.rules[2]},
+	}
+
+	for _, test := range tests {
+		if next, at := schedule.nextRule(test.now); next != test.next || !at.Equal(test.at) {
+			t.Errorf("nextRule(%v) = %+v at %v, expected %+v at %v", test.now, next, at, test.next, test.at)
+		}
+		if current := schedule.currentRule(test.now); current != test.current {
+			t.Errorf("currentRule(%v) = %+v, expected %+v", test.now, current, test.current)
+		}
+	}
+
+	var empty scheduler
+	if next, _ := empty.nextRule(now); next != nil {
+		t.Errorf("nextRule = %+v without rules", next)
+	}
+	if current := empty.currentRule(now); current != nil {
+		t.Errorf("currentRule = %+v without rules", current)
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	var rule = ScheduleRule{Hour: 7, Minute: 0, Target: embermug.Celsius(60)}
+
+	for _, catchUp := range []bool{false, true} {
+		var options = []Option{WithSchedule(rule)}
+		if catchUp {
+			options = append(options, WithScheduleCatchUp())
+		}
+
+		var (
+			svc         = New(nil, bluetooth.Address{}, options...)
+			ctx, cancel = context.WithCancel(context.Background())
+			done        = make(chan struct{})
+		)
+
+		go func() {
+			defer close(done)
+			svc.runScheduler(ctx)
+		}()
+
+		// The next change is published once the scheduler has started
+		for deadline := time.Now().Add(5 * time.Second); svc.State().NextChange.Time.IsZero(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("scheduler did not publish the next change")
+			}
+		}
+
+		svc.mugLock.Lock()
+		pending := svc.schedule.pending
+		svc.mugLock.Unlock()
+
+		cancel()
+		<-done
+
+		// The most recent rule is only applied with catch up enabled, and
+		// waits for the mug to be connected.
+		if catchUp && pending != &svc.schedule.rules[0] {
+			t.Errorf("pending = %+v with catch up, expected %+v", pending, rule)
+		} else if !catchUp && pending != nil {
+			t.Errorf("pending = %+v without catch up", pending)
+		}
+	}
+}
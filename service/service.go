@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
-	"net"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/calebstewart/go-embermug"
 	"github.com/google/uuid"
@@ -16,7 +17,7 @@ import (
 )
 
 // Service encapsulates the centralized interaction with an [embermug.Mug]
-// across multiple potential clients. The service maintains a [net.Listener]
+// across multiple potential clients. The service maintains [Listener]s
 // where clients can connect, and receive status updates in JSON format.
 // Additionally, clients can send [Message] objects (in JSON format) to the
 // service to make changes to mug or manually refresh the state.
@@ -28,13 +29,24 @@ type Service struct {
 	clients          map[string]*Client // Mapping of unique client IDs to client objects
 	mugLock          sync.Locker        // Lock for the mug client
 	mug              *embermug.Mug      // Mug client created from a bluetooth device
+	lastEvent        time.Time          // Time of the last event or poll (guarded by mugLock)
+	poll             PollConfig         // Fallback polling configuration
+	eta              etaEstimator       // Time-to-target estimator (guarded by mugLock)
+	battery          batteryEstimator   // Battery runtime estimator (guarded by mugLock)
+	sessions         sessionTracker     // Drink session detection (guarded by mugLock)
+	presets          []Preset           // Named presets ordered by name
+	schedule         scheduler          // Scheduled target changes (guarded by mugLock)
+	syncClock        bool               // Whether to synchronize the mug clock
+	metrics          metrics            // Service counters
+	access           []AccessRule       // Socket client access rules (empty allows every client)
+	idle             idleTracker        // Socket client tracking for the idle timeout
 }
 
 // New returns a new (non-running) service object. The service will manage
 // an ember mug device at the given bluetooth address using the given bluetooth
-// adapter.
-func New(adapter *bluetooth.Adapter, device bluetooth.Address) *Service {
-	return &Service{
+// adapter. Optional behavior can be enabled by passing one or more [Option]s.
+func New(adapter *bluetooth.Adapter, device bluetooth.Address, options ...Option) *Service {
+	s := &Service{
 		bluetoothAdapter: adapter,
 		deviceAddress:    device,
 		state:            State{},
@@ -43,14 +55,21 @@ func New(adapter *bluetooth.Adapter, device bluetooth.Address) *Service {
 		mugLock:          &sync.Mutex{},
 		mug:              nil,
 	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
 }
 
 // Run executes the service main loop. The service will run indefinitely or
-// until the context is closed. It will accept clients from the listener,
-// and write mug state updates to the listener in JSON format. Data sent
+// until the context is closed. It will accept clients from every listener,
+// and write mug state updates to the clients in JSON format. Data sent
 // to the service from the client must be newline-delimeted JSON. Each
 // object must be a [Message] object with some command for the service.
-func (s *Service) Run(ctx context.Context, socket net.Listener) error {
+// If any listener fails, the service stops and the error is returned.
+func (s *Service) Run(ctx context.Context, listeners ...Listener) error {
 	defer s.disconnect()
 
 	var group sync.WaitGroup
@@ -59,13 +78,15 @@ func (s *Service) Run(ctx context.Context, socket net.Listener) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Ensure the socket is closed if the context is closed
+	// Ensure the listeners are closed if the context is closed
 	group.Add(1)
 	go func() {
 		defer group.Done()
 		<-ctx.Done()
 		slog.Info("Received shutdown request")
-		socket.Close()
+		for _, listener := range listeners {
+			listener.Close()
+		}
 	}()
 
 	// Attempt to connect multiple times because the Ember Mug is dumb as hell
@@ -78,20 +99,64 @@ func (s *Service) Run(ctx context.Context, socket net.Listener) error {
 
 	s.bluetoothAdapter.SetConnectHandler(s.handleConnectionEvent)
 
-	for {
-		// Accept a client connection
-		conn, err := socket.Accept()
-		if err != nil {
-			return err
-		}
+	// Keep the mug clock synchronized across timezone changes and suspend
+	if s.syncClock {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			s.runClockWatcher(ctx)
+		}()
+	}
+
+	// Apply scheduled target changes in the background
+	if len(s.schedule.rules) > 0 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			s.runScheduler(ctx)
+		}()
+	}
+
+	// Stop the service once no socket clients remain for the idle timeout
+	if s.idle.timeout > 0 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			s.runIdleMonitor(ctx, cancel)
+		}()
+	}
+
+	// Poll the mug in the background in case event notifications stall
+	if s.poll.Interval > 0 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			s.runPoller(ctx)
+		}()
+	}
 
-		// Handle the client in the background
+	// Accept clients from each listener in the background. The first
+	// listener to fail stops the service.
+	var (
+		errOnce sync.Once
+		runErr  error
+	)
+	for _, listener := range listeners {
 		group.Add(1)
 		go func() {
 			defer group.Done()
-			s.handleClient(ctx, conn)
+			if err := s.acceptClients(ctx, listener, &group); err != nil {
+				errOnce.Do(func() {
+					runErr = fmt.Errorf("listener %v: %w", listener.Addr(), err)
+					cancel()
+				})
+			}
 		}()
 	}
+
+	// The error is written before the context is cancelled
+	<-ctx.Done()
+	return runErr
 }
 
 // lockMug locks the mug lock and returns the current mug client
@@ -123,6 +188,13 @@ func (s *Service) handleConnectionEvent(device bluetooth.Device, connected bool)
 	} else {
 		s.mug = mug
 		s.state.Connected = true
+		s.lastEvent = time.Now()
+
+		if name, err := mug.GetName(); err != nil {
+			slog.Error("Could not update mug name", "Error", err)
+		} else {
+			s.state.Name = name
+		}
 
 		if state, err := mug.GetState(); err != nil {
 			slog.Error("Could not update liquid state", "Error", err)
@@ -154,8 +226,13 @@ func (s *Service) handleConnectionEvent(device bluetooth.Device, connected bool)
 			s.state.Battery = battery
 		}
 
+		if s.syncClock {
+			s.syncClockLocked(mug, "connected")
+		}
+
 		slog.Debug(
 			"Connected to mug",
+			"Name", s.state.Name,
 			"State", s.state.State,
 			"CurrentTempF", s.state.Current.Fahrenheit(),
 			"TargetTempF", s.state.Target.Fahrenheit(),
@@ -166,7 +243,7 @@ func (s *Service) handleConnectionEvent(device bluetooth.Device, connected bool)
 	}
 
 	// Send updated state to all clients
-	s.dispatchState(s.state)
+	s.publishLocked()
 }
 
 // connect connects to the target mug, saves the client to the
@@ -175,7 +252,10 @@ func (s *Service) handleConnectionEvent(device bluetooth.Device, connected bool)
 // lock.
 func (s *Service) connect() (device *bluetooth.Device, lastErr error) {
 	for try := 0; try < 10; try++ {
-		if d, err := s.bluetoothAdapter.Connect(s.deviceAddress, bluetooth.ConnectionParams{}); err != nil {
+		d, err := s.bluetoothAdapter.Connect(s.deviceAddress, bluetooth.ConnectionParams{})
+		s.metrics.connectAttempt(err)
+
+		if err != nil {
 			slog.Debug("Failed to connect to device", "Error", err, "Try", try)
 			lastErr = err
 		} else {
@@ -217,7 +297,19 @@ func (s *Service) handleEvent(event embermug.Event) {
 	}
 
 	slog.Debug("Received Mug Event", "Event", event)
+	s.lastEvent = time.Now()
+	s.metrics.event(event)
 
+	if s.refreshLocked(mug, event) {
+		s.publishLocked()
+	}
+}
+
+// refreshLocked re-reads the characteristic associated with the given event
+// and updates the service state. It returns true if the state changed. This
+// is the single change-detection path for both mug events and the polling
+// fallback. You must hold the mug lock before invoking this method.
+func (s *Service) refreshLocked(mug *embermug.Mug, event embermug.Event) bool {
 	var changed = true
 
 	// Handle update events
@@ -286,14 +378,38 @@ func (s *Service) handleEvent(event embermug.Event) {
 		s.state.Battery.Charging = false
 	}
 
-	if changed {
-		s.dispatchState(s.state)
-	}
+	return changed
+}
+
+// publishLocked updates the fields of the service state which are derived
+// from recent readings (such as estimates), and then dispatches the state to
+// all clients. You must hold the mug lock before invoking this method.
+func (s *Service) publishLocked() {
+	var now = time.Now()
+
+	s.applyScheduleLocked()
+
+	s.state.ETA = s.eta.Observe(now, s.state)
+	s.state.TimeToEmpty, s.state.TimeToFull = s.battery.Observe(now, s.state)
+	s.state.SessionsToday = s.sessions.Observe(now, s.state)
+	s.state.Preset = s.matchPreset(s.state.Target)
+	s.state.NextChange = s.schedule.next
+
+	s.dispatchState(s.state)
+}
+
+// State returns a copy of the current state of the mug as known by the service.
+func (s *Service) State() State {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+	return s.state
 }
 
 // dispatchState sends the given state object to all registered clients.
 // This method is also responsible for cleaning up clients which have
-// been canceled.
+// been canceled. Dispatching never blocks on a slow client. If a client's
+// channel is full, its oldest pending state is dropped in favor of the new
+// one, so every client eventually observes the most recent state.
 func (s *Service) dispatchState(state State) {
 	s.clientLock.Lock()
 	defer s.clientLock.Unlock()
@@ -303,11 +419,31 @@ func (s *Service) dispatchState(state State) {
 		case <-client.Context.Done():
 			close(client.Channel)
 			delete(s.clients, key)
+			continue
+		default:
+		}
+
+		select {
 		case client.Channel <- state:
+		default:
+			slog.Debug("Client is not keeping up; dropping oldest state", "ClientID", client.ID)
+			s.metrics.updateDropped()
+
+			// Only the dispatcher sends on the channel, and we hold the
+			// client lock, so there is room after removing one state.
+			select {
+			case <-client.Channel:
+			default:
+			}
+			client.Channel <- state
 		}
 	}
 }
 
+// clientBufferSize is the number of states buffered for each client before
+// the oldest pending state is dropped.
+const clientBufferSize = 16
+
 // RegisterClient creates a new state channel, and registers it with the
 // service. The returned client object can be used to receive state
 // objects whenever the target ember mug changes state. When the client
@@ -321,7 +457,7 @@ func (s *Service) RegisterClient(ctx context.Context) *Client {
 	var (
 		key    = uuid.New().String()
 		client = Client{
-			Channel: make(chan State),
+			Channel: make(chan State, clientBufferSize),
 			Context: ctx,
 			Cancel:  cancel,
 			ID:      key,
@@ -333,26 +469,41 @@ func (s *Service) RegisterClient(ctx context.Context) *Client {
 	defer s.clientLock.Unlock()
 
 	s.clients[key] = &client
+	s.metrics.clientRegistered()
 
 	return &client
 }
 
+// ServeClient serves a client connection which was not accepted by the
+// listener passed to [Service.Run], such as a WebSocket. The connection uses
+// the same newline-delimited JSON protocol as socket clients. This method
+// blocks until the connection is closed or the context is done. The caller is
+// responsible for authenticating the connection, so the client may send
+// messages to control the mug.
+func (s *Service) ServeClient(ctx context.Context, conn io.ReadWriteCloser) {
+	s.handleClient(ctx, conn, RoleControl)
+}
+
 // handleClient is invoked for each client connection. This method is
 // expected to run in it's own goroutine, and handles both the read
 // and write ends of the client connection itself. It will register
 // itself as a client using [registerClient], and then process
-// state changes, and client messages appropriately.
-func (s *Service) handleClient(ctx context.Context, conn net.Conn) {
+// state changes, and client messages appropriately. Messages from clients
+// without the [RoleControl] role are rejected.
+func (s *Service) handleClient(ctx context.Context, conn io.ReadWriteCloser, role Role) {
 	var (
 		group       = sync.WaitGroup{}
 		client      = s.RegisterClient(ctx)
 		messageChan = make(chan Message)
 		encoder     = json.NewEncoder(conn)
-		logger      = slog.With(slog.String("ClientID", client.ID))
+		logger      = slog.With(slog.String("ClientID", client.ID), slog.String("Role", role.String()))
 	)
 
 	logger.Debug("Client Connected")
 
+	s.idle.connected()
+	defer s.idle.disconnected()
+
 	// Execute the input handler
 	group.Add(1)
 	go func() {
@@ -385,7 +536,7 @@ func (s *Service) handleClient(ctx context.Context, conn net.Conn) {
 
 	defer logger.Debug("Client disconnecting")
 
-	if err := s.sendStateToClient(encoder, s.state); errors.Is(err, syscall.EPIPE) {
+	if err := s.sendUpdateToClient(encoder, Update{State: s.State()}); errors.Is(err, syscall.EPIPE) {
 		return
 	} else if err != nil {
 		logger.Error("Failed to write initial state to client", "Error", err)
@@ -403,18 +554,33 @@ func (s *Service) handleClient(ctx context.Context, conn net.Conn) {
 				return
 			}
 
-			if msg.Reconnect {
-				// Any received message means "connect to the mug"
-				logger.Debug("Client received mug connection request")
-				if _, err := s.connect(); errors.Is(err, syscall.EPIPE) {
-					return
-				} else if err != nil {
-					logger.Error("Could not connect to device", "Error", err)
-					return
-				}
+			var err error
+			if role < RoleControl {
+				err = ErrPermissionDenied
+				logger.Warn("Denied client message", "MessageID", msg.ID)
+			} else if err = s.handleMessage(logger, msg); err != nil {
+				logger.Error("Could not handle client message", "Error", err)
+			}
+
+			if msg.ID == "" {
+				continue
+			}
+
+			var reply = Reply{ID: msg.ID}
+			if err != nil {
+				reply.Error = err.Error()
 			}
-		case state := <-client.Channel:
-			if err := s.sendStateToClient(encoder, state); errors.Is(err, syscall.EPIPE) {
+
+			if err := s.sendUpdateToClient(encoder, Update{State: s.State(), Reply: &reply}); errors.Is(err, syscall.EPIPE) {
+				return
+			} else if err != nil {
+				logger.Error("Could not write reply to client", "Error", err)
+				return
+			}
+		case state, ok := <-client.Channel:
+			if !ok {
+				return
+			} else if err := s.sendUpdateToClient(encoder, Update{State: state}); errors.Is(err, syscall.EPIPE) {
 				return
 			} else if err != nil {
 				logger.Error("Could not write state to client", "Error", err)
@@ -424,33 +590,92 @@ func (s *Service) handleClient(ctx context.Context, conn net.Conn) {
 	}
 }
 
-// sendStateToClient serializes the given state as a JSON object, and writes it to the
+// HandleMessage executes the commands in a message on behalf of an in-process
+// integration rather than a socket client.
+func (s *Service) HandleMessage(msg Message) error {
+	return s.handleMessage(slog.Default(), msg)
+}
+
+// handleMessage executes the commands in a single client message. The
+// first command which fails stops processing of the message.
+func (s *Service) handleMessage(logger *slog.Logger, msg Message) error {
+	if msg.Reconnect {
+		logger.Debug("Client received mug connection request")
+		if _, err := s.connect(); s.metrics.command(CommandReconnect, err) != nil {
+			return fmt.Errorf("could not connect to device: %w", err)
+		}
+	}
+
+	if msg.ApplyPreset != "" {
+		logger.Debug("Client requested preset", "Preset", msg.ApplyPreset)
+		if err := s.metrics.command(CommandApplyPreset, s.ApplyPreset(msg.ApplyPreset)); err != nil {
+			return fmt.Errorf("could not apply preset %q: %w", msg.ApplyPreset, err)
+		}
+	}
+
+	if msg.SetTarget != 0 {
+		logger.Debug("Client requested target temperature", "TargetF", msg.SetTarget.Fahrenheit())
+		if err := s.metrics.command(CommandSetTarget, s.SetTarget(msg.SetTarget)); err != nil {
+			return fmt.Errorf("could not set target temperature: %w", err)
+		}
+	}
+
+	if msg.AdjustTarget != 0 {
+		logger.Debug("Client requested target adjustment", "Delta", msg.AdjustTarget.Celsius())
+		if err := s.metrics.command(CommandAdjustTarget, s.AdjustTarget(msg.AdjustTarget)); err != nil {
+			return fmt.Errorf("could not adjust target temperature: %w", err)
+		}
+	}
+
+	if msg.SetColor != nil {
+		logger.Debug("Client requested LED color", "Color", *msg.SetColor)
+		if err := s.metrics.command(CommandSetColor, s.SetColor(*msg.SetColor)); err != nil {
+			return fmt.Errorf("could not set LED color: %w", err)
+		}
+	}
+
+	if msg.SetName != "" {
+		logger.Debug("Client requested mug name", "Name", msg.SetName)
+		if err := s.metrics.command(CommandSetName, s.SetName(msg.SetName)); err != nil {
+			return fmt.Errorf("could not set mug name: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sendUpdateToClient serializes the given update as a JSON object, and writes it to the
 // client encoder.
-func (s *Service) sendStateToClient(encoder *json.Encoder, state State) error {
-	return encoder.Encode(state)
+func (s *Service) sendUpdateToClient(encoder *json.Encoder, update Update) error {
+	return encoder.Encode(update)
 }
 
 // parseAndDeliverClientMessages reads messages from the given client connection, parses them as
 // [Message] objects, and then delivers them to [messageChan]. The function will continue until
 // an EOF or read error is encountered. This could be due to the client being closed or due to
-// an invalid message being sent by the client. In either case, the function will return. This
-// function is normally only executed in a background routine from [Service.handleClient].
+// an invalid message being sent by the client. In either case, the function will return and
+// cancel the client, so [Service.handleClient] stops without waiting for the next state update.
+// This function is normally only executed in a background routine from [Service.handleClient].
 func (s *Service) parseAndDeliverClientMessages(client *Client, conn io.Reader, messageChan chan Message) {
-	var (
-		decoder *json.Decoder = json.NewDecoder(conn)
-		message Message
-	)
+	var decoder *json.Decoder = json.NewDecoder(conn)
+
+	defer client.Cancel()
 
 	for decoder.More() {
+		var message Message
+
 		if err := decoder.Decode(&message); errors.Is(err, syscall.EPIPE) {
 			return
 		} else if err != nil {
 			slog.Error("Failed to decode client message", "Error", err, "ClientID", client.ID)
-			client.Cancel()
 			return
 		} else {
 			slog.Debug("Received message from client", "ClientID", client.ID)
-			messageChan <- message
+			select {
+			case messageChan <- message:
+			case <-client.Context.Done():
+				return
+			}
 		}
 	}
 }
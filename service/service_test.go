@@ -0,0 +1,76 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// testConn is a client connection which reads the given messages followed
+// by an EOF, and records what the service writes.
+type testConn struct {
+	io.Reader
+	lock   sync.Mutex
+	output bytes.Buffer
+}
+
+func (c *testConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.output.Write(p)
+}
+
+func (c *testConn) Close() error {
+	return nil
+}
+
+func TestServeClientEOF(t *testing.T) {
+	var (
+		svc  = New(nil, bluetooth.Address{}, WithIdleTimeout(time.Hour))
+		conn = &testConn{Reader: strings.NewReader(`{"ID": "last"}`)}
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		svc.ServeClient(context.Background(), conn)
+	}()
+
+	// No state is dispatched, so only the end of the input stops the client
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client was not stopped after its input ended")
+	}
+
+	svc.idle.lock.Lock()
+	clients := svc.idle.clients
+	svc.idle.lock.Unlock()
+	if clients != 0 {
+		t.Errorf("%v clients still counted as connected", clients)
+	}
+
+	// Messages sent before the input ended are still answered
+	var (
+		decoder = json.NewDecoder(&conn.output)
+		replied bool
+	)
+	for decoder.More() {
+		var update Update
+		if err := decoder.Decode(&update); err != nil {
+			t.Fatalf("invalid update: %v", err)
+		} else if update.Reply != nil && update.Reply.ID == "last" {
+			replied = update.Reply.Error == ""
+		}
+	}
+	if !replied {
+		t.Errorf("no reply to the last message in %q", conn.output.String())
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// Session describes a single "drink session". A session starts when the mug
+// is filled, and ends when the mug reports that it is empty. Topping up the
+// mug before it is empty counts as a refill within the same session.
+type Session struct {
+	Start           time.Time            // Time the mug was first filled
+	End             time.Time            // Time the mug was emptied
+	FillTemperature embermug.Temperature // Temperature of the liquid after filling
+	FirstStable     time.Time            // Time the target temperature was first reached (zero if never)
+	TimeAtTarget    time.Duration        // Total time spent stable at the target temperature
+	Refills         int                  // Number of times the mug was refilled before being emptied
+}
+
+// sessionTracker detects drink sessions from the liquid state transitions
+// reported by the mug. Completed sessions are appended to a file as
+// newline-delimited JSON.
+type sessionTracker struct {
+	path       string         // Path to append completed sessions (empty to disable)
+	active     *Session       // The session in progress, if any
+	filled     bool           // Whether the fill temperature has been recorded for the active session
+	lastState  embermug.State // Liquid state at the last observation
+	lastTime   time.Time      // Time of the last observation
+	today      string         // Date for which todayCount is valid
+	todayCount int            // Number of sessions started on today
+}
+
+// Load counts the sessions started today from the given path so the count
+// survives restarts. A missing file is not an error. The path is also used
+// to persist future sessions.
+func (t *sessionTracker) Load(path string, now time.Time) error {
+	t.path = path
+	t.today = now.Format(time.DateOnly)
+	t.todayCount = 0
+
+	for session, err := range ReadSessions(path) {
+		if err != nil {
+			return err
+		} else if session.Start.Local().Format(time.DateOnly) == t.today {
+			t.todayCount += 1
+		}
+	}
+
+	return nil
+}
+
+// Observe updates the active session from the given state, and returns the
+// number of sessions started today (including the active session).
+func (t *sessionTracker) Observe(now time.Time, state State) int {
+	if date := now.Format(time.DateOnly); date != t.today {
+		t.today = date
+		t.todayCount = 0
+	}
+
+	if t.active != nil && t.lastState == embermug.StateStable {
+		t.active.TimeAtTarget += now.Sub(t.lastTime)
+	}
+
+	if !state.Connected {
+		// Keep the active session in case the mug reconnects, but do not
+		// count time while disconnected as time at target.
+		t.lastState = embermug.StateInvalid
+		t.lastTime = now
+		return t.todayCount
+	}
+
+	switch {
+	case state.State == embermug.StateFilling && t.lastState != embermug.StateFilling:
+		if t.active == nil {
+			t.start(now)
+		} else {
+			t.active.Refills += 1
+		}
+	case t.active == nil && t.lastState == embermug.StateEmpty && state.HasLiquid && state.State != embermug.StateEmpty:
+		// The filling state was missed, but the mug went from empty to full
+		t.start(now)
+	}
+
+	if t.active != nil {
+		if !t.filled && state.State != embermug.StateFilling {
+			t.active.FillTemperature = state.Current
+			t.filled = true
+		}
+
+		if state.State == embermug.StateStable && t.active.FirstStable.IsZero() {
+			t.active.FirstStable = now
+		}
+
+		if state.State == embermug.StateEmpty {
+			t.active.End = now
+			t.finish()
+		}
+	}
+
+	t.lastState = state.State
+	t.lastTime = now
+
+	return t.todayCount
+}
+
+// start begins a new active session
+func (t *sessionTracker) start(now time.Time) {
+	slog.Debug("Drink session started")
+
+	t.active = &Session{Start: now}
+	t.filled = false
+	t.todayCount += 1
+}
+
+// finish persists the active session, and clears it
+func (t *sessionTracker) finish() {
+	var session = t.active
+	t.active = nil
+
+	slog.Debug(
+		"Drink session ended",
+		"Duration", session.End.Sub(session.Start),
+		"TimeAtTarget", session.TimeAtTarget,
+		"Refills", session.Refills,
+	)
+
+	if t.path == "" {
+		return
+	} else if err := appendSession(t.path, session); err != nil {
+		slog.Warn("Could not record drink session", "Path", t.path, "Error", err)
+	}
+}
+
+// appendSession appends a single session to the sessions file
+func appendSession(path string, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// ReadSessions returns an iterator over the completed drink sessions recorded
+// in the given file, in the order they ended. A missing file yields nothing.
+// Malformed records are skipped, so errors are only yielded for I/O failures.
+func ReadSessions(path string) iter.Seq2[Session, error] {
+	return func(yield func(Session, error) bool) {
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		} else if err != nil {
+			yield(Session{}, err)
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			var session Session
+
+			// A crash may leave a truncated record, which should not
+			// prevent reading the remaining sessions.
+			if err := json.Unmarshal(scanner.Bytes(), &session); err != nil {
+				slog.Warn("Skipping malformed session record", "Path", path, "Line", line, "Error", err)
+			} else if !yield(session, nil) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(Session{}, fmt.Errorf("%v: %w", path, err))
+		}
+	}
+}
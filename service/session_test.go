@@ -0,0 +1,247 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// sessionObservation is a single observed mug state, at a number of minutes
+// from the start of the test.
+type sessionObservation struct {
+	minutes   int
+	state     embermug.State
+	hasLiquid bool
+	current   float64 // Current temperature in celsius
+	offline   bool    // The mug is disconnected
+}
+
+func observeSessions(tracker *sessionTracker, start time.Time, observations []sessionObservation) (counts []int) {
+	for _, o := range observations {
+		counts = append(counts, tracker.Observe(start.Add(time.Duration(o.minutes)*time.Minute), State{
+			Connected: !o.offline,
+			State:     o.state,
+			HasLiquid: o.hasLiquid,
+			Current:   embermug.Celsius(o.current),
+		}))
+	}
+	return counts
+}
+
+// readAllSessions reads every session from the given file
+func readAllSessions(t *testing.T, path string) []Session {
+	t.Helper()
+
+	var sessions []Session
+	for session, err := range ReadSessions(path) {
+		if err != nil {
+			t.Fatalf("ReadSessions: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func TestSessionTracker(t *testing.T) {
+	var (
+		start  = time.Date(2024, time.March, 10, 8, 0, 0, 0, time.Local)
+		minute = func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	)
+
+	tests := []struct {
+		name         string
+		observations []sessionObservation
+		counts       []int     // Sessions today after each observation
+		expected     []Session // Completed sessions
+		active       bool      // Whether a session is still in progress
+	}{
+		{
+			name: "session",
+			observations: []sessionObservation{
+				{minutes: 0, state: embermug.StateEmpty},
+				{minutes: 1, state: embermug.StateFilling, hasLiquid: true, current: 30},
+				{minutes: 2, state: embermug.StateHeating, hasLiquid: true, current: 62},
+				{minutes: 5, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 15, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 20, state: embermug.StateEmpty, current: 40},
+			},
+			counts: []int{0, 1, 1, 1, 1, 1},
+			expected: []Session{{
+				Start:           minute(1),
+				End:             minute(20),
+				FillTemperature: embermug.Celsius(62),
+				FirstStable:     minute(5),
+				TimeAtTarget:    15 * time.Minute,
+			}},
+		},
+		{
+			name: "refill",
+			observations: []sessionObservation{
+				{minutes: 0, state: embermug.StateFilling, hasLiquid: true},
+				{minutes: 1, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 11, state: embermug.StateFilling, hasLiquid: true},
+				{minutes: 12, state: embermug.StateFilling, hasLiquid: true},
+				{minutes: 13, state: embermug.StateCooling, hasLiquid: true, current: 65},
+				{minutes: 20, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 30, state: embermug.StateEmpty},
+			},
+			counts: []int{1, 1, 1, 1, 1, 1, 1},
+			expected: []Session{{
+				Start:           minute(0),
+				End:             minute(30),
+				FillTemperature: embermug.Celsius(57),
+				FirstStable:     minute(1),
+				TimeAtTarget:    20 * time.Minute,
+				Refills:         1,
+			}},
+		},
+		{
+			// The filling state is not always observed, but the mug going
+			// from empty to holding liquid starts a session.
+			name: "missed filling",
+			observations: []sessionObservation{
+				{minutes: 0, state: embermug.StateEmpty},
+				{minutes: 5, state: embermug.StateHeating, hasLiquid: true, current: 50},
+				{minutes: 8, state: embermug.StateStable, hasLiquid: true, current: 57},
+			},
+			counts: []int{0, 1, 1},
+			active: true,
+		},
+		{
+			// Liquid observed after connecting may belong to a session
+			// which started before the service, so no session is started.
+			name: "connected with liquid",
+			observations: []sessionObservation{
+				{minutes: 0, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 10, state: embermug.StateEmpty},
+			},
+			counts: []int{0, 0},
+		},
+		{
+			name: "disconnect",
+			observations: []sessionObservation{
+				{minutes: 0, state: embermug.StateFilling, hasLiquid: true},
+				{minutes: 1, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 5, offline: true},
+				{minutes: 60, state: embermug.StateStable, hasLiquid: true, current: 57},
+				{minutes: 62, state: embermug.StateEmpty},
+			},
+			counts: []int{1, 1, 1, 1, 1},
+			expected: []Session{{
+				Start:           minute(0),
+				End:             minute(62),
+				FillTemperature: embermug.Celsius(57),
+				FirstStable:     minute(1),
+				TimeAtTarget:    6 * time.Minute,
+			}},
+		},
+		{
+			name: "consecutive sessions",
+			observations: []sessionObservation{
+				{minutes: 0, state: embermug.StateFilling, hasLiquid: true},
+				{minutes: 1, state: embermug.StateHeating, hasLiquid: true, current: 50},
+				{minutes: 10, state: embermug.StateEmpty},
+				{minutes: 20, state: embermug.StateFilling, hasLiquid: true},
+				{minutes: 21, state: embermug.StateCooling, hasLiquid: true, current: 70},
+				{minutes: 30, state: embermug.StateEmpty},
+			},
+			counts: []int{1, 1, 1, 2, 2, 2},
+			expected: []Session{
+				{Start: minute(0), End: minute(10), FillTemperature: embermug.Celsius(50)},
+				{Start: minute(20), End: minute(30), FillTemperature: embermug.Celsius(70)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				path    = filepath.Join(t.TempDir(), "sessions.ndjson")
+				tracker sessionTracker
+			)
+
+			if err := tracker.Load(path, start); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if counts := observeSessions(&tracker, start, test.observations); !slices.Equal(counts, test.counts) {
+				t.Errorf("counts = %v, expected %v", counts, test.counts)
+			}
+
+			sessions := readAllSessions(t, path)
+			if len(sessions) != len(test.expected) {
+				t.Fatalf("sessions = %+v, expected %+v", sessions, test.expected)
+			}
+			for index, session := range sessions {
+				if !sessionEqual(session, test.expected[index]) {
+					t.Errorf("session %v = %+v, expected %+v", index, session, test.expected[index])
+				}
+			}
+
+			if active := tracker.active != nil; active != test.active {
+				t.Errorf("active = %v, expected %v", active, test.active)
+			}
+		})
+	}
+}
+
+func TestSessionTrackerToday(t *testing.T) {
+	var (
+		path     = filepath.Join(t.TempDir(), "sessions.ndjson")
+		midnight = time.Date(2024, time.March, 11, 0, 0, 0, 0, time.Local)
+		tracker  sessionTracker
+	)
+
+	// Sessions from yesterday and today, and a truncated record
+	var data []byte
+	for _, start := range []time.Time{midnight.Add(-2 * time.Hour), midnight.Add(time.Hour), midnight.Add(2 * time.Hour)} {
+		data = append(data, `{"Start":"`+start.Format(time.RFC3339)+`","End":"`+start.Add(10*time.Minute).Format(time.RFC3339)+`"}`+"\n"...)
+	}
+	data = append(data, `{"Start":"2024-03-11T0`+"\n"...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.Load(path, midnight.Add(3*time.Hour)); err != nil {
+		t.Fatalf("Load: %v", err)
+	} else if tracker.todayCount != 2 {
+		t.Fatalf("todayCount = %v after loading, expected 2", tracker.todayCount)
+	}
+
+	// A session spanning midnight counts towards the day it started, and
+	// the count resets once the day changes.
+	counts := observeSessions(&tracker, midnight.Add(23*time.Hour+50*time.Minute), []sessionObservation{
+		{minutes: 0, state: embermug.StateFilling, hasLiquid: true},
+		{minutes: 5, state: embermug.StateStable, hasLiquid: true, current: 57},
+		{minutes: 15, state: embermug.StateStable, hasLiquid: true, current: 57},
+		{minutes: 20, state: embermug.StateEmpty},
+		{minutes: 30, state: embermug.StateFilling, hasLiquid: true},
+	})
+	if expected := []int{3, 3, 0, 0, 1}; !slices.Equal(counts, expected) {
+		t.Errorf("counts = %v, expected %v", counts, expected)
+	}
+
+	if sessions := readAllSessions(t, path); len(sessions) != 4 {
+		t.Errorf("%v sessions recorded, expected 4", len(sessions))
+	}
+}
+
+func TestReadSessionsMissing(t *testing.T) {
+	if sessions := readAllSessions(t, filepath.Join(t.TempDir(), "missing.ndjson")); len(sessions) != 0 {
+		t.Errorf("sessions = %v, expected none", sessions)
+	}
+}
+
+// sessionEqual compares sessions, ignoring the location of their times
+func sessionEqual(a, b Session) bool {
+	return a.Start.Equal(b.Start) &&
+		a.End.Equal(b.End) &&
+		a.FirstStable.Equal(b.FirstStable) &&
+		a.FillTemperature == b.FillTemperature &&
+		a.TimeAtTarget == b.TimeAtTarget &&
+		a.Refills == b.Refills
+}
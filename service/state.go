@@ -3,22 +3,40 @@ package service
 import (
 	"fmt"
 	"log/slog"
+	"reflect"
+	"time"
 
 	"github.com/calebstewart/go-embermug"
 )
 
 type State struct {
-	Connected bool
-	State     embermug.State
-	Target    embermug.Temperature
-	Current   embermug.Temperature
-	Battery   embermug.BatteryState
-	HasLiquid bool
+	Connected   bool
+	Name        string // Name advertised by the mug
+	State       embermug.State
+	Target      embermug.Temperature
+	Current     embermug.Temperature
+	Battery     embermug.BatteryState
+	HasLiquid   bool
+	ETA         time.Duration // Estimated time until Current reaches Target (zero if unknown)
+	TimeToEmpty time.Duration // Estimated time until the battery is empty while discharging (zero if unknown)
+	TimeToFull  time.Duration // Estimated time until the battery is full while charging (zero if unknown)
+
+	SessionsToday int    // Number of drink sessions started today, including the active session
+	Preset        string // Name of the preset matching the target temperature (empty if none)
+
+	NextChange ScheduledChange // Next scheduled target temperature change
+	ClockDrift time.Duration   // Offset of the mug clock from the host clock when last synchronized
 }
 
 func (s *State) Update(mug *embermug.Mug) {
 	s.Connected = true
 
+	if name, err := mug.GetName(); err != nil {
+		slog.Error("Could not update mug name", "Error", err)
+	} else {
+		s.Name = name
+	}
+
 	if state, err := mug.GetState(); err != nil {
 		slog.Error("Could not update liquid state", "Error", err)
 	} else {
@@ -118,3 +136,34 @@ func (s *State) HandleEvent(mug *embermug.Mug, event embermug.Event) (changed bo
 
 	return true, nil
 }
+
+// Change is the previous and new value of a single [State] field
+type Change struct {
+	Old any
+	New any
+}
+
+// Diff returns the fields which differ between the previous state and this
+// state, keyed by field name. Nested structures (such as the battery state)
+// are reported as a single change.
+func (s State) Diff(previous State) map[string]Change {
+	var (
+		changes = make(map[string]Change)
+		current = reflect.ValueOf(s)
+		old     = reflect.ValueOf(previous)
+	)
+
+	for index := range current.NumField() {
+		var (
+			name     = current.Type().Field(index).Name
+			oldValue = old.Field(index).Interface()
+			newValue = current.Field(index).Interface()
+		)
+
+		if oldValue != newValue {
+			changes[name] = Change{Old: oldValue, New: newValue}
+		}
+	}
+
+	return changes
+}
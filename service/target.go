@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/calebstewart/go-embermug"
+)
+
+// The range of target temperatures accepted by the mug
+var (
+	MinTarget = embermug.Celsius(50)
+	MaxTarget = embermug.Celsius(62.5)
+)
+
+var ErrTargetOutOfRange = errors.New("target temperature out of range")
+
+// SetTarget sets the target temperature of the connected mug
+func (s *Service) SetTarget(target embermug.Temperature) error {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+
+	return s.setTargetLocked(target)
+}
+
+// AdjustTarget changes the target temperature of the connected mug by the
+// given (possibly negative) amount.
+func (s *Service) AdjustTarget(delta embermug.Temperature) error {
+	s.mugLock.Lock()
+	defer s.mugLock.Unlock()
+
+	return s.setTargetLocked(s.state.Target + delta)
+}
+
+// setTargetLocked sets the target temperature. You must hold the mug lock
+// before invoking this method.
+func (s *Service) setTargetLocked(target embermug.Temperature) error {
+	if s.mug == nil {
+		return ErrNotConnected
+	}
+
+	if target < MinTarget || target > MaxTarget {
+		return fmt.Errorf(
+			"%w: %.1fF (expected %.1fF to %.1fF)",
+			ErrTargetOutOfRange,
+			target.Fahrenheit(),
+			MinTarget.Fahrenheit(),
+			MaxTarget.Fahrenheit(),
+		)
+	}
+
+	if err := s.mug.SetTargetTemperature(target); err != nil {
+		return err
+	}
+
+	slog.Info("Changed target temperature", "TargetF", target.Fahrenheit())
+
+	s.state.Target = target
+	s.publishLocked()
+
+	return nil
+}